@@ -0,0 +1,86 @@
+package router
+
+import "net/http"
+
+const (
+	// Header the api key is read from by default.
+	APIKeyHeader = "X-API-Key"
+	// Query param the api key is read from by default.
+	APIKeyQuery = "api_key"
+)
+
+// Where an APIKeyFilter reads the key from.
+const (
+	HeaderOrQuery KeySource = iota
+	HeaderOnly
+	QueryOnly
+)
+
+type (
+	KeySource int
+	// APIKeyFilter rejects requests without a valid api key with a 401.
+	//
+	//  Usage:
+	//
+	//      go_router.RegisterFilter("api_key", &go_router.APIKeyFilter{
+	//          Source: go_router.HeaderOnly,
+	//          Lookup: keys.Valid,
+	//      })
+	//
+	APIKeyFilter struct {
+		// Header holding the key, X-API-Key when empty.
+		Header string
+		// Query param holding the key, api_key when empty.
+		Query string
+		// Where the key is read from, the header then
+		// the query param by default.
+		Source KeySource
+		// Reports whether a key is valid.
+		Lookup func(key string) bool
+	}
+)
+
+// Get the query param holding the key.
+func (f *APIKeyFilter) query() string {
+	if f.Query == "" {
+		return APIKeyQuery
+	}
+	return f.Query
+}
+
+// Get the api key of a request.
+func (f *APIKeyFilter) key(r *http.Request) string {
+	header := f.Header
+	if header == "" {
+		header = APIKeyHeader
+	}
+	var key string
+	if f.Source != QueryOnly {
+		key = r.Header.Get(header)
+	}
+	if key == "" && f.Source != HeaderOnly {
+		key = r.URL.Query().Get(f.query())
+	}
+	return key
+}
+
+func (f *APIKeyFilter) Name() string {
+	return "api_key"
+}
+
+// Verify the api key of the request.
+// The query param is dropped, so it is never bound by the controller.
+func (f *APIKeyFilter) PreDispatch(r *http.Request, req Request) error {
+	key := f.key(r)
+	if key == "" || f.Lookup == nil || !f.Lookup(key) {
+		return ErrUnauthorized
+	}
+	if f.Source != HeaderOnly {
+		delete(req, f.query())
+	}
+	return nil
+}
+
+func (f *APIKeyFilter) PostDispatch(r *http.Request, req Request) error {
+	return nil
+}
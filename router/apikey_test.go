@@ -0,0 +1,76 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func validKey(key string) bool {
+	return key == "good"
+}
+
+// Dispatch a request with an api key in the header and query.
+func withKey(path string, header string, query string) int {
+	if query != "" {
+		path += "?api_key=" + query
+	}
+	r := httptest.NewRequest("GET", path, nil)
+	if header != "" {
+		r.Header.Set(APIKeyHeader, header)
+	}
+	return serve(r).Code
+}
+
+func TestAPIKeyFilter(t *testing.T) {
+	Reset()
+	RegisterFilter("api_key", &APIKeyFilter{Lookup: validKey})
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	tests := []struct {
+		header string
+		query  string
+		want   int
+	}{
+		{"good", "", 200},
+		{"", "good", 200},
+		{"bad", "", 401},
+		{"", "bad", 401},
+		{"", "", 401},
+	}
+	for _, tt := range tests {
+		if code := withKey("/v1/test/retrieve", tt.header, tt.query); code != tt.want {
+			t.Errorf("header %q query %q: got %d, want %d", tt.header, tt.query, code, tt.want)
+		}
+	}
+}
+
+func TestAPIKeySource(t *testing.T) {
+	Reset()
+	RegisterFilter("header", &APIKeyFilter{Source: HeaderOnly, Lookup: validKey})
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	if code := withKey("/v1/test/retrieve", "", "good"); code != 401 {
+		t.Fatalf("got %d for a query key with HeaderOnly", code)
+	}
+	Reset()
+	RegisterFilter("query", &APIKeyFilter{Source: QueryOnly, Lookup: validKey})
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	if code := withKey("/v1/test/retrieve", "good", ""); code != 401 {
+		t.Fatalf("got %d for a header key with QueryOnly", code)
+	}
+}
+
+func TestAPIKeyBeforeBinding(t *testing.T) {
+	Reset()
+	RegisterFilter("api_key", &APIKeyFilter{Lookup: validKey})
+	RegisterRoute("GET", "/v1/test/search", func(t *queryInput) (map[string]string, error) { return t.Query, nil })
+	RegisterRoute("GET", "/v1/test/count", func(t *typedInput) (int64, error) { return t.Count, nil })
+	if code := withKey("/v1/test/count/count/x", "", ""); code != 401 {
+		t.Fatalf("got %d, want 401 before the bad param", code)
+	}
+	if code := withKey("/v1/test/count/missing/1", "", ""); code != 401 {
+		t.Fatalf("got %d, want 401 before the unknown param", code)
+	}
+	w := serve(httptest.NewRequest("GET", "/v1/test/search?api_key=good&color=red", nil))
+	if w.Code != 200 || w.Body.String() != `{"color":"red"}` {
+		t.Fatalf("got %d %s, the key should not be bound", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type bindInput struct {
+	Id     int64
+	Name   string
+	Active bool
+	Price  float64
+	TTL    time.Duration `param:"ttl"`
+	Tags   []string
+}
+
+func bindController(t *bindInput) (*bindInput, error) {
+	return t, nil
+}
+
+func TestBind(t *testing.T) {
+	Reset()
+	v, err := Bind(bindController, Request{
+		"id":     {Value: "42"},
+		"name":   {Value: "alice"},
+		"active": {Value: true},
+		"price":  {Value: 9.5},
+		"ttl":    {Value: "30s"},
+		"tags":   {Value: "a,b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &bindInput{Id: 42, Name: "alice", Active: true, Price: 9.5, TTL: 30 * time.Second, Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("got %+v, want %+v", v, want)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	Reset()
+	_, err := Bind(bindController, Request{
+		"id":     {Value: "x"},
+		"active": {Value: "maybe"},
+	})
+	errs, ok := err.(FieldErrors)
+	want := FieldErrors{{Field: "active", Message: "Invalid boolean"}, {Field: "id", Message: "Invalid integer"}}
+	if !ok || !reflect.DeepEqual(errs, want) {
+		t.Fatalf("got %v", err)
+	}
+	if _, err := Bind(bindController, Request{"color": {Value: "red"}}); err == nil {
+		t.Fatal("expected an error for an unknown param")
+	}
+	if _, err := Bind(func(s string) string { return s }, Request{}); err == nil {
+		t.Fatal("expected an error for a controller without an input struct")
+	}
+}
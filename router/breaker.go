@@ -0,0 +1,146 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// States of the circuit of a route.
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	// letting a single trial request through.
+	circuitHalfOpen
+)
+
+type (
+	circuitState int
+	circuit      struct {
+		state    circuitState
+		failures int
+		// when the circuit opened or the trial started.
+		openedAt time.Time
+	}
+	// CircuitBreakerFilter stops calling the controller of a route once it
+	// failed Failures times in a row, rejecting its requests with a 503.
+	// After the cooldown a single trial request is let through, closing
+	// the circuit when it succeeds and opening it again when it fails.
+	// Controllers failing with ErrNotFound or an HTTPError below 500
+	// are not failures.
+	//
+	//  Usage:
+	//
+	//      go_router.RegisterFilter("breaker", &go_router.CircuitBreakerFilter{
+	//          Failures: 5,
+	//          Cooldown: 30 * time.Second,
+	//      })
+	//
+	CircuitBreakerFilter struct {
+		// Consecutive failures opening the circuit, 5 when zero.
+		Failures int
+		// Time the circuit stays open, 30s when zero.
+		Cooldown time.Duration
+		mu       sync.Mutex
+		// circuits by route.
+		circuits map[*route]*circuit
+		// the time, replaced in tests.
+		now func() time.Time
+	}
+)
+
+// Check if a controller outcome counts against its circuit.
+func isFailure(o Outcome) bool {
+	if o.Err == nil || errors.Is(o.Err, ErrNotFound) {
+		return false
+	}
+	if e, ok := asHTTPError(o.Err); ok {
+		return e.Status == 0 || e.Status >= http.StatusInternalServerError
+	}
+	return true
+}
+
+func (f *CircuitBreakerFilter) failures() int {
+	if f.Failures <= 0 {
+		return 5
+	}
+	return f.Failures
+}
+
+func (f *CircuitBreakerFilter) cooldown() time.Duration {
+	if f.Cooldown <= 0 {
+		return 30 * time.Second
+	}
+	return f.Cooldown
+}
+
+func (f *CircuitBreakerFilter) time() time.Time {
+	if f.now != nil {
+		return f.now()
+	}
+	return time.Now()
+}
+
+// Get the circuit of a route.
+// Must be called with the lock held.
+func (f *CircuitBreakerFilter) circuit(rt *route) *circuit {
+	if f.circuits == nil {
+		f.circuits = make(map[*route]*circuit)
+	}
+	c, ok := f.circuits[rt]
+	if !ok {
+		c = &circuit{}
+		f.circuits[rt] = c
+	}
+	return c
+}
+
+func (f *CircuitBreakerFilter) Name() string {
+	return "circuit_breaker"
+}
+
+// Reject the request while the circuit of its route is open.
+func (f *CircuitBreakerFilter) PreDispatch(r *http.Request, req Request) error {
+	rt := getRoute(r)
+	if rt == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.circuit(rt)
+	if c.state == circuitClosed {
+		return nil
+	}
+	// a trial rejected by another filter never reports back,
+	// so a new one is let through after another cooldown.
+	if f.time().Sub(c.openedAt) < f.cooldown() {
+		return HTTPError{Status: http.StatusServiceUnavailable}
+	}
+	c.state, c.openedAt = circuitHalfOpen, f.time()
+	return nil
+}
+
+func (f *CircuitBreakerFilter) PostDispatch(r *http.Request, req Request) error {
+	return nil
+}
+
+// Count the outcome against the circuit of the route.
+func (f *CircuitBreakerFilter) PostDispatchResult(r *http.Request, req Request, o Outcome) error {
+	rt := getRoute(r)
+	if rt == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.circuit(rt)
+	if !isFailure(o) {
+		c.state, c.failures = circuitClosed, 0
+		return nil
+	}
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= f.failures() {
+		c.state, c.openedAt = circuitOpen, f.time()
+	}
+	return nil
+}
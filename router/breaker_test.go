@@ -0,0 +1,65 @@
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	Reset()
+	now := time.Now()
+	breaker := &CircuitBreakerFilter{Failures: 3, Cooldown: time.Minute, now: func() time.Time { return now }}
+	RegisterFilter("breaker", breaker)
+	failing := true
+	calls := 0
+	RegisterRoute("GET", "/v1/downstream/get", func(t *testInput) (string, error) {
+		calls++
+		if failing {
+			return "", errors.New("downstream is down")
+		}
+		return "ok", nil
+	})
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	logged, restore := captureLog()
+	defer restore()
+	for i := 0; i < 3; i++ {
+		if w := do("GET", "/v1/downstream/get", ""); w.Code != 500 {
+			t.Fatalf("got %d", w.Code)
+		}
+	}
+	if w := do("GET", "/v1/downstream/get", ""); w.Code != 503 || calls != 3 {
+		t.Fatalf("got %d after %d calls, want the circuit open", w.Code, calls)
+	}
+	if w := do("GET", "/v1/users/1", ""); w.Code != 200 {
+		t.Fatalf("got %d, other routes have their own circuit", w.Code)
+	}
+	// a failed trial opens the circuit again.
+	now = now.Add(time.Minute)
+	do("GET", "/v1/downstream/get", "")
+	if w := do("GET", "/v1/downstream/get", ""); w.Code != 503 || calls != 4 {
+		t.Fatalf("got %d after %d calls, want the circuit open again", w.Code, calls)
+	}
+	// a successful trial closes it.
+	now = now.Add(time.Minute)
+	failing = false
+	for i := 0; i < 2; i++ {
+		if w := do("GET", "/v1/downstream/get", ""); w.Code != 200 {
+			t.Fatalf("got %d, want the circuit closed", w.Code)
+		}
+	}
+	if logged.Len() == 0 {
+		t.Fatal("expected the failures to be logged")
+	}
+}
+
+func TestCircuitBreakerClientErrors(t *testing.T) {
+	Reset()
+	RegisterFilter("breaker", &CircuitBreakerFilter{Failures: 1})
+	RegisterRoute("GET", "/v1/users/{id}", func(t *testInput) (string, error) { return "", ErrNotFound })
+	for i := 0; i < 3; i++ {
+		if w := do("GET", "/v1/users/1", ""); w.Code != 404 {
+			t.Fatalf("got %d, a missing resource is not a failure", w.Code)
+		}
+	}
+}
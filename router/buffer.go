@@ -0,0 +1,161 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// responseBuffer holds a response until Dispatch is done with it, so the
+// status and headers can still change, or the response be replaced by
+// an error, right up to the single write.
+type responseBuffer struct {
+	w      http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// writes go straight to w once unbuffered,
+	// the status is still kept for the filters.
+	direct bool
+	// the status has been written to w, and the response
+	// can no longer be replaced.
+	committed bool
+	// content encoding negotiated for the body, if any.
+	encoding   string
+	compressor Compressor
+	// the body is dropped, as HEAD requests need.
+	head bool
+}
+
+func newResponseBuffer(w http.ResponseWriter) *responseBuffer {
+	return &responseBuffer{w: w, header: make(http.Header)}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	if b.direct {
+		return b.w.Header()
+	}
+	return b.header
+}
+
+// Set the status of the response.
+// Once the response is committed a later status is dropped.
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+	if b.direct && !b.committed {
+		b.committed = true
+		b.w.WriteHeader(status)
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	if b.direct {
+		b.committed = true
+		if b.head {
+			return len(p), nil
+		}
+		return b.w.Write(p)
+	}
+	return b.body.Write(p)
+}
+
+// Flush the response when it is unbuffered.
+// Buffered responses are only written by flush.
+func (b *responseBuffer) Flush() {
+	if b.direct {
+		flush(b.w)
+	}
+}
+
+// Drop the buffered response, so another one can be written.
+func (b *responseBuffer) reset() {
+	if b.direct {
+		return
+	}
+	b.header = make(http.Header)
+	b.status = 0
+	b.body.Reset()
+}
+
+// Write what has been buffered and pass every
+// later write straight through, as streams need.
+func (b *responseBuffer) unbuffer() error {
+	if b.direct {
+		return nil
+	}
+	for k, v := range b.header {
+		b.w.Header()[k] = v
+	}
+	b.direct = true
+	if b.status != 0 {
+		b.committed = true
+		b.w.WriteHeader(b.status)
+	}
+	if b.body.Len() > 0 && !b.head {
+		_, err := b.w.Write(b.body.Bytes())
+		return err
+	}
+	return nil
+}
+
+// Unbuffer a stream or an unbuffered route, clearing the write
+// deadline an earlier response on the connection may have left.
+func (b *responseBuffer) stream() error {
+	if WriteTimeout > 0 {
+		setWriteDeadline(b.w, time.Time{})
+	}
+	return b.unbuffer()
+}
+
+// Write the buffered response, compressed in the
+// negotiated content encoding.
+func (b *responseBuffer) flush() error {
+	if b.direct {
+		return nil
+	}
+	if b.body.Len() > 0 && b.header.Get("Content-Encoding") == "" {
+		b.header.Add("Vary", "Accept-Encoding")
+		if b.compressor != nil {
+			data, err := compress(b.compressor, b.body.Bytes())
+			if err != nil {
+				return err
+			}
+			b.body.Reset()
+			b.body.Write(data)
+			b.header.Set("Content-Encoding", b.encoding)
+			b.header.Del("Content-Length")
+		}
+	}
+	if b.body.Len() > 0 && b.header.Get("Content-Length") == "" {
+		b.header.Set("Content-Length", strconv.Itoa(b.body.Len()))
+	}
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	if WriteTimeout > 0 {
+		// kept until the response is sent, after Dispatch returns.
+		setWriteDeadline(b.w, time.Now().Add(WriteTimeout))
+	}
+	return b.unbuffer()
+}
+
+// Logged the first time a ResponseWriter does not support deadlines.
+var deadlineUnsupported sync.Once
+
+// Set the write deadline of the connection of a response, a zero time
+// clearing it. The response is written without one, and it is logged
+// once, when the ResponseWriter does not support deadlines.
+func setWriteDeadline(w http.ResponseWriter, t time.Time) {
+	if err := http.NewResponseController(w).SetWriteDeadline(t); err != nil {
+		deadlineUnsupported.Do(func() {
+			Logger.Printf("WriteTimeout is not enforced: %v", err)
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Rejects every response once it is written.
+type lateErrorFilter struct{}
+
+func (f lateErrorFilter) Name() string {
+	return "late"
+}
+
+func (f lateErrorFilter) PreDispatch(r *http.Request, req Request) error {
+	return nil
+}
+
+func (f lateErrorFilter) PostDispatch(r *http.Request, req Request) error {
+	return HTTPError{Status: http.StatusBadGateway, Message: "late"}
+}
+
+func TestLateError(t *testing.T) {
+	Reset()
+	RegisterFilter("late", lateErrorFilter{})
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	w := do("GET", "/v1/test/retrieve/id/4", "")
+	if w.Code != 502 || w.Body.String() != `{"status":502,"message":"late"}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestResponseBuffering(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	RegisterRoute("GET", "/v1/test/direct", testController, WithoutBuffering())
+	if w := do("GET", "/v1/test/retrieve/id/4", ""); w.Code != 200 || w.Header().Get("Content-Length") != "3" {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Length"))
+	}
+	w := do("GET", "/v1/test/direct/id/4", "")
+	if w.Code != 200 || w.Body.String() != `"4"` || w.Header().Get("Content-Length") != "" {
+		t.Fatalf("got %d %s %q", w.Code, w.Body, w.Header().Get("Content-Length"))
+	}
+}
+
+// Fails every write, as a client gone away does.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestWriteError(t *testing.T) {
+	Reset()
+	logged, restore := captureLog()
+	defer restore()
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	RegisterRoute("GET", "/v1/users/list", func(t *testInput) (<-chan interface{}, error) {
+		ch := make(chan interface{})
+		go func() {
+			defer close(ch)
+			for i := 0; i < 100; i++ {
+				select {
+				case ch <- i:
+				case <-time.After(time.Second):
+					return
+				}
+			}
+		}()
+		return ch, nil
+	})
+	r := httptest.NewRequest("GET", "/v1/users/4", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	Dispatch(failingWriter{httptest.NewRecorder()}, r)
+	want := "GET /v1/users/4 (GET /v1/users/{id}) request abc: can not write the response: broken pipe"
+	if !strings.Contains(logged.String(), want) {
+		t.Fatalf("got log %q", logged)
+	}
+	logged.Reset()
+	Dispatch(failingWriter{httptest.NewRecorder()}, httptest.NewRequest("GET", "/v1/users/list", nil))
+	if strings.Count(logged.String(), "can not write the stream: broken pipe") != 1 {
+		t.Fatalf("got log %q", logged)
+	}
+}
+
+// Counts the statuses written to it.
+type headerCounter struct {
+	*httptest.ResponseRecorder
+	statuses int
+}
+
+func (w *headerCounter) WriteHeader(status int) {
+	w.statuses++
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+// Sends one event and then panics.
+type brokenStream struct{}
+
+func (brokenStream) Stream(ctx context.Context, w *SSEWriter) error {
+	w.Send("tick", "1")
+	panic("stream broke")
+}
+
+func TestCommittedResponse(t *testing.T) {
+	Reset()
+	logged, restore := captureLog()
+	defer restore()
+	RegisterRoute("GET", "/v1/ticks/stream", func(t *testInput) (SSEStream, error) { return brokenStream{}, nil })
+	w := &headerCounter{ResponseRecorder: httptest.NewRecorder()}
+	Dispatch(w, httptest.NewRequest("GET", "/v1/ticks/stream", nil))
+	if w.statuses != 1 || w.Code != 200 || w.Body.String() != "event: tick\ndata: 1\n\n" {
+		t.Fatalf("got %d statuses, %d %q", w.statuses, w.Code, w.Body)
+	}
+	if !strings.Contains(logged.String(), "stream broke") || !strings.Contains(logged.String(), "response already started") {
+		t.Fatalf("got log %q", logged)
+	}
+}
+
+// Records the write deadlines set on it.
+type deadlineWriter struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+}
+
+func (w *deadlineWriter) SetWriteDeadline(t time.Time) error {
+	w.deadlines = append(w.deadlines, t)
+	return nil
+}
+
+func TestWriteTimeout(t *testing.T) {
+	Reset()
+	logged, restore := captureLog()
+	defer restore()
+	WriteTimeout = time.Minute
+	defer func() { WriteTimeout = 0 }()
+	deadlineUnsupported = sync.Once{}
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	RegisterRoute("GET", "/v1/users/list", func(t *testInput) (<-chan interface{}, error) { return nil, nil })
+
+	// the deadline is left in place for the server to send the response.
+	w := &deadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+	start := time.Now()
+	Dispatch(w, httptest.NewRequest("GET", "/v1/users/4", nil))
+	if w.Body.String() != `"4"` || len(w.deadlines) != 1 || w.deadlines[0].Before(start.Add(WriteTimeout)) {
+		t.Fatalf("got %q, deadlines %v", w.Body, w.deadlines)
+	}
+	w = &deadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+	Dispatch(w, httptest.NewRequest("GET", "/v1/users/list", nil))
+	if w.Body.String() != "[]" || len(w.deadlines) != 1 || !w.deadlines[0].IsZero() {
+		t.Fatalf("stream: got %q, deadlines %v", w.Body, w.deadlines)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(Dispatch))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/v1/users/4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || logged.Len() != 0 {
+		t.Fatalf("got %d, log %q", resp.StatusCode, logged)
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := do("GET", "/v1/users/4", ""); w.Code != 200 || w.Body.String() != `"4"` {
+			t.Fatalf("got %d %s without deadlines", w.Code, w.Body)
+		}
+	}
+	if strings.Count(logged.String(), "WriteTimeout is not enforced") != 1 {
+		t.Fatalf("got log %q", logged)
+	}
+}
@@ -0,0 +1,117 @@
+package router
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Headers reporting the address a proxy received a request from.
+const (
+	ForwardedForHeader = "X-Forwarded-For"
+	RealIPHeader       = "X-Real-Ip"
+)
+
+// networks of the proxies trusted to set the proxy headers,
+// guarded by mu. Only the peer is trusted when empty.
+var trustedProxies []*net.IPNet
+
+// Trust the proxy headers only from peers in the given networks,
+// such as 10.0.0.0/8, when TrustProxyHeaders is on. Proxies chained
+// in front of the peer must be listed too, to be skipped in
+// X-Forwarded-For. With no networks only the peer, the proxy in
+// front of the router, is trusted, and the address it adds last to
+// X-Forwarded-For is the client.
+//
+//  Usage:
+//
+//      go_router.TrustProxyHeaders = true
+//      go_router.SetTrustedProxies("10.0.0.0/8", "192.168.1.1/32")
+//
+func SetTrustedProxies(cidrs ...string) error {
+	var networks []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return errors.New("Invalid proxy network " + c)
+		}
+		networks = append(networks, n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	trustedProxies = networks
+	return nil
+}
+
+// Check if an address is in the networks of the trusted proxies.
+func isTrustedProxy(ip net.IP) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the address of the peer of a request, without its port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Check if the proxy headers of a request can be trusted.
+func trustedPeer(r *http.Request) bool {
+	if !TrustProxyHeaders {
+		return false
+	}
+	mu.RLock()
+	peerOnly := len(trustedProxies) == 0
+	mu.RUnlock()
+	if peerOnly {
+		return true
+	}
+	ip := net.ParseIP(remoteIP(r))
+	return ip != nil && isTrustedProxy(ip)
+}
+
+// Get the address of the client that sent a request, for filters
+// that rate limit or log. Behind a trusted proxy it is the last
+// address of X-Forwarded-For that is not a trusted proxy, or
+// X-Real-Ip when there is none. It is the address of the peer
+// otherwise, as when TrustProxyHeaders is off.
+//
+//  Usage:
+//
+//      ip := go_router.ClientIP(r)
+//
+func ClientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	if !trustedPeer(r) {
+		return peer
+	}
+	if forwarded := r.Header.Values(ForwardedForHeader); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip.String()
+			if !isTrustedProxy(ip) {
+				break
+			}
+		}
+		return client
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get(RealIPHeader))); ip != nil {
+		return ip.String()
+	}
+	return peer
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	Reset()
+	defer func() { TrustProxyHeaders = false }()
+	tests := []struct {
+		name      string
+		trust     bool
+		proxies   []string
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"no header", true, nil, "10.0.0.2:1234", "", "", "10.0.0.2"},
+		{"untrusted headers", false, nil, "10.0.0.2:1234", "203.0.113.9", "", "10.0.0.2"},
+		{"trusted proxy", true, nil, "10.0.0.2:1234", "203.0.113.9", "", "203.0.113.9"},
+		{"spoofed hop", true, nil, "10.0.0.2:1234", "6.6.6.6, 203.0.113.9", "", "203.0.113.9"},
+		{"real ip", true, nil, "10.0.0.2:1234", "", "203.0.113.9", "203.0.113.9"},
+		{"proxy outside networks", true, []string{"10.0.0.0/8"}, "198.51.100.7:1234", "203.0.113.9", "", "198.51.100.7"},
+		{"chained proxies", true, []string{"10.0.0.0/8"}, "10.0.0.2:1234", "1.2.3.4, 203.0.113.9, 10.0.0.5", "", "203.0.113.9"},
+		{"malformed hop", true, []string{"10.0.0.0/8"}, "10.0.0.2:1234", "203.0.113.9, bogus, 10.0.0.5", "", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		TrustProxyHeaders = tt.trust
+		if err := SetTrustedProxies(tt.proxies...); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/v1/users/4", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set(ForwardedForHeader, tt.forwarded)
+		}
+		if tt.realIP != "" {
+			r.Header.Set(RealIPHeader, tt.realIP)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if err := SetTrustedProxies("10.0.0.0"); err == nil {
+		t.Fatal("an address without a mask was accepted")
+	}
+}
@@ -0,0 +1,136 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Compressor wraps a response body in a content encoding.
+	Compressor    func(w io.Writer) io.WriteCloser
+	compressorMap map[string]Compressor
+)
+
+// guarded by mu, like the encoders.
+var compressors = defaultCompressors()
+
+// Content encodings preferred when the client accepts several
+// equally. Other registered encodings come after them.
+var compressorPreference = []string{"br", "gzip"}
+
+// Get the compressors every router starts with.
+func defaultCompressors() compressorMap {
+	return compressorMap{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	}
+}
+
+// Register a compressor for a content encoding, so buffered responses
+// are compressed for clients sending it in Accept-Encoding.
+// Among the encodings a client accepts equally br is preferred,
+// then gzip, and a response is sent as is when it accepts none.
+// Streams and unbuffered routes are never compressed.
+//
+//  Usage:
+//
+//      go_router.RegisterCompressor("br", func(w io.Writer) io.WriteCloser {
+//          return brotli.NewWriter(w)
+//      })
+//
+func RegisterCompressor(encoding string, c Compressor) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := compressors[encoding]; ok {
+		return errors.New("Compressor encoding is already registered")
+	}
+	compressors[encoding] = c
+	return nil
+}
+
+// Get the rank of a content encoding among the preferred ones.
+func preference(encoding string) int {
+	for i, v := range compressorPreference {
+		if v == encoding {
+			return i
+		}
+	}
+	return len(compressorPreference)
+}
+
+// Parse an Accept-Encoding header into the quality of each encoding.
+func acceptEncodings(header string) map[string]float64 {
+	q := make(map[string]float64)
+	for _, v := range strings.Split(header, ",") {
+		parts := strings.Split(v, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+		quality := 1.0
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					quality = f
+				}
+			}
+		}
+		q[name] = quality
+	}
+	return q
+}
+
+// Get the compressor of the content encoding a request accepts best.
+// Returns false when it accepts none of the registered ones.
+func negotiateCompressor(r *http.Request) (string, Compressor, bool) {
+	header := r.Header.Get("Accept-Encoding")
+	if header == "" {
+		return "", nil, false
+	}
+	q := acceptEncodings(header)
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(compressors))
+	for name := range compressors {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if a, b := preference(names[i]), preference(names[j]); a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+	best, bestQ := "", 0.0
+	for _, name := range names {
+		v, ok := q[name]
+		if !ok {
+			v = q["*"]
+		}
+		if v > bestQ {
+			best, bestQ = name, v
+		}
+	}
+	if best == "" {
+		return "", nil, false
+	}
+	return best, compressors[best], true
+}
+
+// Compress a response body.
+func compress(c Compressor, body []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := c(&b)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+// Marks its output, so a test can tell which compressor ran.
+type fakeBrotli struct {
+	w io.Writer
+}
+
+func (f fakeBrotli) Write(p []byte) (int, error) {
+	return f.w.Write(append([]byte("br:"), p...))
+}
+
+func (f fakeBrotli) Close() error {
+	return nil
+}
+
+func compressedRequest(accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/v1/test/retrieve/id/4", nil)
+	r.Header.Set("Accept-Encoding", accept)
+	return serve(r)
+}
+
+func TestCompression(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	w := compressedRequest("gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("got headers %v", w.Header())
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(gz); string(b) != `"4"` {
+		t.Fatalf("got %q", b)
+	}
+
+	if err := RegisterCompressor("br", func(w io.Writer) io.WriteCloser { return fakeBrotli{w} }); err != nil {
+		t.Fatal(err)
+	}
+	w = compressedRequest("br, gzip")
+	if w.Header().Get("Content-Encoding") != "br" || w.Body.String() != `br:"4"` {
+		t.Fatalf("got %q %s", w.Header().Get("Content-Encoding"), w.Body)
+	}
+	if w := compressedRequest("br;q=0.5, gzip"); w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got %q, want the higher quality", w.Header().Get("Content-Encoding"))
+	}
+	w = compressedRequest("identity")
+	if w.Header().Get("Content-Encoding") != "" || !bytes.Equal(w.Body.Bytes(), []byte(`"4"`)) || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("got %v %s", w.Header(), w.Body)
+	}
+}
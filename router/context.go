@@ -0,0 +1,138 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+type (
+	contextKey int
+	// Values set by filters during a request.
+	// Kept in order so a later value for a key wins.
+	contextValues struct {
+		keys   []interface{}
+		values []interface{}
+		// the request body, kept once it is read.
+		body []byte
+		// the route matched by the request.
+		route *route
+	}
+)
+
+const valuesKey contextKey = iota
+
+var (
+	contextType        = reflect.TypeOf((*context.Context)(nil)).Elem()
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+)
+
+// Attach an empty value store to the request context.
+func withValues(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), valuesKey, &contextValues{}))
+}
+
+// Get the value store of a request.
+func getValues(r *http.Request) *contextValues {
+	v, _ := r.Context().Value(valuesKey).(*contextValues)
+	return v
+}
+
+// Build the context handed to a controller.
+// It carries every value set by the filters.
+func controllerContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if v := getValues(r); v != nil {
+		for k, key := range v.keys {
+			ctx = context.WithValue(ctx, key, v.values[k])
+		}
+	}
+	return ctx
+}
+
+// Set a value for the controller from a filter.
+// The controller reads it from its context. As with context.WithValue,
+// use an unexported key type defined in your own package so keys set
+// by different filters can not collide.
+//
+//  Usage:
+//
+//      type userKey struct{}
+//
+//      func (f *BearerTokenFilter) PreDispatch(r *http.Request, req router.Request) error {
+//          router.SetValue(r, userKey{}, user)
+//          return nil
+//      }
+//
+//      func GetProfile(ctx context.Context, t *Test) (string, error) {
+//          user := ctx.Value(userKey{}).(*User)
+//          ...
+//      }
+//
+func SetValue(r *http.Request, key interface{}, value interface{}) {
+	if v := getValues(r); v != nil {
+		v.keys = append(v.keys, key)
+		v.values = append(v.values, value)
+	}
+}
+
+// Get a value set by a filter.
+// Falls back to the request context.
+func Value(r *http.Request, key interface{}) interface{} {
+	if v := getValues(r); v != nil {
+		for k := len(v.keys) - 1; k >= 0; k-- {
+			if v.keys[k] == key {
+				return v.values[k]
+			}
+		}
+	}
+	return r.Context().Value(key)
+}
+
+// Keep the route matched by a request for the filters.
+func setRoute(r *http.Request, rt *route) {
+	if v := getValues(r); v != nil {
+		v.route = rt
+	}
+}
+
+// Get the route matched by a request.
+func getRoute(r *http.Request) *route {
+	if v := getValues(r); v != nil {
+		return v.route
+	}
+	return nil
+}
+
+// Keep the body of a request once it is read.
+func setBody(r *http.Request, body []byte) {
+	if v := getValues(r); v != nil {
+		v.body = body
+	}
+}
+
+// Decode the json body of a request into v.
+// Lets filters read the body, which is consumed before they run.
+//
+//  Usage:
+//
+//      func (f *SignatureFilter) PreDispatch(r *http.Request, req router.Request) error {
+//          var signed struct {
+//              Signature string
+//          }
+//          if err := router.BindJSON(r, &signed); err != nil {
+//              return err
+//          }
+//          ...
+//      }
+//
+func BindJSON(r *http.Request, v interface{}) error {
+	values := getValues(r)
+	if values == nil || values.body == nil {
+		return errors.New("Request body has not been read")
+	}
+	return json.Unmarshal(values.body, v)
+}
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+type userKey struct{}
+
+// Sets the user for the controller and checks
+// it is still there after the controller ran.
+type userFilter struct {
+	seen *interface{}
+}
+
+func (f userFilter) Name() string {
+	return "user"
+}
+
+func (f userFilter) PreDispatch(r *http.Request, req Request) error {
+	SetValue(r, userKey{}, "alice")
+	return nil
+}
+
+func (f userFilter) PostDispatch(r *http.Request, req Request) error {
+	*f.seen = Value(r, userKey{})
+	return nil
+}
+
+func TestFilterValues(t *testing.T) {
+	Reset()
+	var seen interface{}
+	RegisterFilter("user", userFilter{&seen})
+	RegisterRoute("GET", "/v1/test/user", func(ctx context.Context, t *testInput) (string, error) {
+		user, _ := ctx.Value(userKey{}).(string)
+		return user, nil
+	})
+	w := do("GET", "/v1/test/user", "")
+	if w.Code != 200 || w.Body.String() != `"alice"` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if seen != "alice" {
+		t.Fatalf("got %v in PostDispatch", seen)
+	}
+}
+
+// Reads the signature out of the body.
+type signatureFilter struct {
+	signature *string
+}
+
+func (f signatureFilter) Name() string {
+	return "signature"
+}
+
+func (f signatureFilter) PreDispatch(r *http.Request, req Request) error {
+	var signed struct {
+		Signature string
+	}
+	if err := BindJSON(r, &signed); err != nil {
+		return err
+	}
+	*f.signature = signed.Signature
+	return nil
+}
+
+func (f signatureFilter) PostDispatch(r *http.Request, req Request) error {
+	return nil
+}
+
+type signedInput struct {
+	Signature string
+	Amount    int64
+}
+
+func TestBindJSON(t *testing.T) {
+	Reset()
+	var signature string
+	RegisterFilter("signature", signatureFilter{&signature})
+	RegisterRoute("POST", "/v1/payments/create", func(t *signedInput) (string, error) { return t.Signature, nil })
+	w := do("POST", "/v1/payments/create", `{"signature":"abc","amount":5}`)
+	if w.Code != 200 || w.Body.String() != `"abc"` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if signature != "abc" {
+		t.Fatalf("got %q in the filter", signature)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/payments/create", func(t *signedInput) (string, error) { return t.Signature, nil })
+	defer func(n int64) { MaxBodySize = n }(MaxBodySize)
+	MaxBodySize = 16
+	if w := do("POST", "/v1/payments/create", `{"signature":"abcdefghijklmnop"}`); w.Code != 413 {
+		t.Fatalf("got %d, want 413", w.Code)
+	}
+	if w := do("POST", "/v1/payments/create", `{"amount":5}`); w.Code != 200 {
+		t.Fatalf("got %d under the limit", w.Code)
+	}
+}
+
+func TestEmptyBody(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/payments/create", func(t *signedInput) (int64, error) { return t.Amount, nil })
+	for _, body := range []string{"", "  \n"} {
+		if w := do("POST", "/v1/payments/create?amount=5", body); w.Code != 200 || w.Body.String() != "5" {
+			t.Errorf("%q: got %d %s", body, w.Code, w.Body)
+		}
+	}
+	_, restore := captureLog()
+	defer restore()
+	if w := do("POST", "/v1/payments/create", "{"); w.Code == 200 {
+		t.Fatal("expected a malformed body to be rejected")
+	}
+}
+
+func TestReplaceFilter(t *testing.T) {
+	Reset()
+	var first, second interface{}
+	RegisterFilter("user", userFilter{&first})
+	if err := RegisterFilter("user", userFilter{&second}); err == nil {
+		t.Fatal("expected an error registering a filter name twice")
+	}
+	ReplaceFilter("user", userFilter{&second})
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	if w := do("GET", "/v1/users/4", ""); w.Code != 200 {
+		t.Fatalf("got %d", w.Code)
+	}
+	if first != nil || second != "alice" {
+		t.Fatalf("got %v and %v, want only the replacement to run", first, second)
+	}
+}
+
+func TestPathAndBodyParams(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/test/save", func(t *testInput) (*testInput, error) { return t, nil })
+	RegisterRoute("PUT", "/v1/test/update", func(t *testInput) (*testInput, error) { return t, nil })
+	if w := do("POST", "/v1/test/save/id/42", `{"name":"x"}`); w.Code != 200 || w.Body.String() != `{"Id":"42","Name":"x"}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	// path params come first under the default precedence.
+	if w := do("PUT", "/v1/test/update/id/42", `{"id":"7","name":"x"}`); w.Code != 200 || w.Body.String() != `{"Id":"42","Name":"x"}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/v1/test/save", `{"id":"7"}`); w.Code != 200 || w.Body.String() != `{"Id":"7","Name":""}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,69 @@
+package router
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Method name prefixes mapped to http methods.
+var methodPrefixes = []struct {
+	prefix string
+	method string
+}{
+	{"Get", "GET"},
+	{"Post", "POST"},
+	{"Put", "PUT"},
+	{"Patch", "PATCH"},
+	{"Delete", "DELETE"},
+}
+
+// Get the http method and handler segment of a controller method name.
+// GetUser maps to GET and user.
+func methodRoute(name string) (string, string, bool) {
+	for _, v := range methodPrefixes {
+		rest := strings.TrimPrefix(name, v.prefix)
+		if rest == name || rest == "" {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(rest); !unicode.IsUpper(r) {
+			continue
+		}
+		return v.method, lowerFirst(rest), true
+	}
+	return "", "", false
+}
+
+// Register a route for each controller method of a struct.
+// The http method and path follow from the method name, so
+// GetUser(*UserReq) is registered as GET {prefix}/user.
+// Methods not named after an http method, or without a
+// controller signature, are skipped.
+// The route options apply to every route of the controller.
+//
+//  Usage:
+//
+//      go_router.RegisterController("/v1/users", &user_controller.Users{})
+//      go_router.RegisterController("/v1/reports", &report_controller.Reports{}, go_router.WithTimeout(time.Minute))
+//
+func RegisterController(prefix string, ctrl interface{}, opts ...RouteOption) error {
+	v := reflect.ValueOf(ctrl)
+	prefix = strings.TrimRight(prefix, "/")
+	for i := 0; i < v.NumMethod(); i++ {
+		name := v.Type().Method(i).Name
+		method, handler, ok := methodRoute(name)
+		if !ok {
+			continue
+		}
+		n := v.Method(i).Interface()
+		if _, err := inputType(n); err != nil {
+			continue
+		}
+		if err := RegisterRoute(method, prefix+"/"+handler, n, opts...); err != nil {
+			return errors.New(name + ": " + err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"testing"
+)
+
+type users struct {
+	count int64
+}
+
+type userInput struct {
+	Id int64
+}
+
+func (u *users) GetUser(t *userInput) (int64, error) {
+	return u.count + t.Id, nil
+}
+
+func (u *users) PostUser(t *userInput) (string, error) {
+	return "saved", nil
+}
+
+// not named after an http method.
+func (u *users) Getaway(t *userInput) (string, error) {
+	return "", nil
+}
+
+// no controller signature.
+func (u *users) GetCount() int64 {
+	return u.count
+}
+
+// no error result.
+func (u *users) GetName(t *userInput) string {
+	return ""
+}
+
+func TestRegisterController(t *testing.T) {
+	Reset()
+	if err := RegisterController("/v1/users/", &users{count: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if w := do("GET", "/v1/users/user/id/5", ""); w.Code != 200 || w.Body.String() != "15" {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/v1/users/user", `{"id":5}`); w.Code != 200 || w.Body.String() != `"saved"` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	for _, path := range []string{"/v1/users/away", "/v1/users/count", "/v1/users/name"} {
+		if w := do("GET", path+"/id/5", ""); w.Code != 404 {
+			t.Errorf("%s: got %d, want the method skipped", path, w.Code)
+		}
+	}
+}
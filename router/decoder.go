@@ -0,0 +1,71 @@
+package router
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ParamDecoder binds every value sent for a param into a field.
+type ParamDecoder func(values []string) (reflect.Value, error)
+
+// param decoders by field type, guarded by mu.
+var decoders = make(map[reflect.Type]ParamDecoder)
+
+// Get the param decoder of a field type.
+func getParamDecoder(t reflect.Type) (ParamDecoder, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	fn, ok := decoders[t]
+	return fn, ok
+}
+
+// Get the values of a param as strings.
+// The elements of a json list are values of their own.
+func paramStrings(p *RequestParam) []string {
+	var s []string
+	for _, v := range p.sent() {
+		switch v := v.(type) {
+		case string:
+			s = append(s, v)
+		case []interface{}:
+			for _, e := range v {
+				s = append(s, fmt.Sprint(e))
+			}
+		default:
+			s = append(s, fmt.Sprint(v))
+		}
+	}
+	return s
+}
+
+// Bind a param into a field with a param decoder.
+func decodeParam(f reflect.Value, fn ParamDecoder, p *RequestParam) error {
+	v, err := fn(paramStrings(p))
+	if err != nil {
+		return err
+	}
+	if !v.IsValid() || !v.Type().AssignableTo(f.Type()) {
+		// log the error and panic
+		panic(fmt.Sprintf("param decoder for %s returned %v", f.Type(), v))
+	}
+	f.Set(v)
+	return nil
+}
+
+// Register a decoder for the fields of a type. It is given every
+// value sent for the param, so repeated params such as
+// sort=name:asc&sort=age:desc bind into one field, and takes
+// precedence over the built-in kinds.
+//
+//  Usage:
+//
+//      go_router.RegisterParamDecoder(reflect.TypeOf([]SortSpec{}), func(values []string) (reflect.Value, error) {
+//          specs, err := parseSort(values)
+//          return reflect.ValueOf(specs), err
+//      })
+//
+func RegisterParamDecoder(t reflect.Type, fn ParamDecoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	decoders[t] = fn
+}
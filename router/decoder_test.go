@@ -0,0 +1,51 @@
+package router
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type SortSpec struct {
+	Field string
+	Desc  bool
+}
+
+type sortInput struct {
+	Sort []SortSpec
+}
+
+func decodeSort(values []string) (reflect.Value, error) {
+	specs := make([]SortSpec, len(values))
+	for i, v := range values {
+		s := strings.Split(v, ":")
+		if len(s) != 2 || (s[1] != "asc" && s[1] != "desc") {
+			return reflect.Value{}, errors.New("Invalid sort")
+		}
+		specs[i] = SortSpec{Field: s[0], Desc: s[1] == "desc"}
+	}
+	return reflect.ValueOf(specs), nil
+}
+
+func TestParamDecoder(t *testing.T) {
+	Reset()
+	RegisterParamDecoder(reflect.TypeOf([]SortSpec{}), decodeSort)
+	RegisterRoute("GET", "/v1/users/search", func(t *sortInput) ([]SortSpec, error) { return t.Sort, nil })
+	RegisterRoute("POST", "/v1/users/sorted", func(t *sortInput) ([]SortSpec, error) { return t.Sort, nil })
+	want := `[{"Field":"name","Desc":false},{"Field":"age","Desc":true}]`
+	if w := do("GET", "/v1/users/search?sort=name:asc&sort=age:desc", ""); w.Code != 200 || w.Body.String() != want {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/v1/users/sorted", `{"sort":["name:asc","age:desc"]}`); w.Code != 200 || w.Body.String() != want {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	ParamPrecedence = ErrorOnConflict
+	defer func() { ParamPrecedence = FirstWins }()
+	if w := do("GET", "/v1/users/search?sort=name:asc&sort=age:desc", ""); w.Code != 200 {
+		t.Fatalf("got %d, repeated params are not a conflict for a decoder", w.Code)
+	}
+	if w := do("GET", "/v1/users/search?sort=name", ""); w.Code != 400 || w.Body.String() != `[{"field":"sort","message":"Invalid sort"}]` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
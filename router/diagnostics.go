@@ -0,0 +1,71 @@
+package router
+
+import (
+	"sort"
+	"time"
+)
+
+type (
+	// The route table served by EnableDiagnostics.
+	diagnostics struct {
+		Routes []routeDiagnostics `json:"routes"`
+		// Filters run for every route.
+		Filters []string `json:"filters"`
+	}
+	routeDiagnostics struct {
+		Method      string   `json:"method"`
+		Path        string   `json:"path"`
+		Controller  string   `json:"controller"`
+		Summary     string   `json:"summary,omitempty"`
+		Tags        []string `json:"tags,omitempty"`
+		Timeout     string   `json:"timeout,omitempty"`
+		CacheMaxAge string   `json:"cache_max_age,omitempty"`
+		Unbuffered  bool     `json:"unbuffered,omitempty"`
+	}
+	diagnosticsInput struct{}
+)
+
+// Serve the registered routes, their options and the filters
+// as json on a GET route. Nothing is served unless it is enabled,
+// and the registered filters run for the route as for any other,
+// so an APIKeyFilter gates it.
+//
+//  Usage:
+//
+//      go_router.EnableDiagnostics("/_routes")
+//
+func EnableDiagnostics(path string) error {
+	return RegisterRoute("GET", path, routeTable)
+}
+
+// Describe the registered routes and filters.
+func routeTable(t *diagnosticsInput) (*diagnostics, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d := &diagnostics{Routes: []routeDiagnostics{}, Filters: []string{}}
+	for _, rt := range sortedRoutes() {
+		d.Routes = append(d.Routes, routeDiagnostics{
+			Method:      rt.method,
+			Path:        rt.path,
+			Controller:  controllerName(rt.node),
+			Summary:     rt.meta.Summary,
+			Tags:        rt.meta.Tags,
+			Timeout:     formatDuration(rt.timeout),
+			CacheMaxAge: formatDuration(rt.cacheMaxAge),
+			Unbuffered:  rt.unbuffered,
+		})
+	}
+	for name := range filters {
+		d.Filters = append(d.Filters, name)
+	}
+	sort.Strings(d.Filters)
+	return d, nil
+}
+
+// Format a route option duration, empty when it is not set.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnostics(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", testController, WithTimeout(time.Second))
+	RegisterFilter("user", userFilter{new(interface{})})
+	if w := do("GET", "/_routes", ""); w.Code == 200 {
+		t.Fatalf("got %d before diagnostics are enabled", w.Code)
+	}
+	if err := EnableDiagnostics("/_routes"); err != nil {
+		t.Fatal(err)
+	}
+	w := do("GET", "/_routes", "")
+	if w.Code != 200 {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	var d diagnostics
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Routes) != 2 || len(d.Filters) != 1 || d.Filters[0] != "user" {
+		t.Fatalf("got %s", w.Body)
+	}
+	user := d.Routes[1]
+	if user.Method != "GET" || user.Path != "/v1/users/{id}" || user.Timeout != "1s" || !strings.HasSuffix(user.Controller, ".testController") {
+		t.Fatalf("got %+v", user)
+	}
+}
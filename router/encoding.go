@@ -0,0 +1,96 @@
+package router
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+const (
+	XML             = "application/xml"
+	defaultEncoding = "json"
+)
+
+type (
+	// Encoder writes a controller response in a content type.
+	Encoder struct {
+		ContentType string
+		Marshal     func(interface{}) ([]byte, error)
+	}
+	encoderMap map[string]Encoder
+)
+
+// guarded by mu, like the routes.
+var encoders = defaultEncoders()
+
+// a request for an extension no encoder is registered for.
+var errNotAcceptable = errors.New("Encoding Not Acceptable")
+
+// Get the encoders every router starts with.
+// The json encoder writes map keys sorted, so the same map
+// always gives the same bytes and needs no option for it.
+func defaultEncoders() encoderMap {
+	return encoderMap{
+		"json": {ContentType: JSON, Marshal: json.Marshal},
+		"xml":  {ContentType: XML, Marshal: xml.Marshal},
+	}
+}
+
+// Get the encoder of a file extension.
+func getEncoder(ext string) (Encoder, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := encoders[ext]
+	return e, ok
+}
+
+// Split the extension off the final segment of a url path.
+func splitExt(path string) (string, string) {
+	path = strings.TrimRight(path, "/")
+	i := strings.LastIndex(path, ".")
+	if i < 0 || strings.Contains(path[i:], "/") {
+		return path, ""
+	}
+	return path[:i], path[i+1:]
+}
+
+// Get the controller for a url path along with the encoder of its response.
+// When the final segment has the extension of a registered encoder the path
+// without it is tried first, so /v1/users/5.xml binds the id 5.
+// Errors with errNotAcceptable when the path only matches once an unknown
+// extension is stripped.
+func matchEncoding(method string, path string, req Request) (*route, Request, Encoder, error) {
+	p, ext := splitExt(path)
+	if e, ok := getEncoder(ext); ok && ext != "" {
+		if rt, req, err := match(method, p, req); err == nil {
+			return rt, req, e, nil
+		}
+	}
+	enc, _ := getEncoder(defaultEncoding)
+	rt, req, err := match(method, path, req)
+	if err != nil && ext != "" {
+		if _, _, e := match(method, p, make(Request)); e == nil {
+			return nil, req, enc, errNotAcceptable
+		}
+	}
+	return rt, req, enc, err
+}
+
+// Register an encoder for a file extension.
+// A request for /v1/report.csv is then routed to /v1/report
+// and its response marshaled by the csv encoder.
+//
+//  Usage:
+//
+//      go_router.RegisterEncoder("csv", go_router.Encoder{ContentType: "text/csv", Marshal: toCSV})
+//
+func RegisterEncoder(ext string, e Encoder) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := encoders[ext]; ok {
+		return errors.New("Encoder extension is already registered")
+	}
+	encoders[ext] = e
+	return nil
+}
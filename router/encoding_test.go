@@ -0,0 +1,133 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type report struct {
+	Name string `json:"name" xml:"name"`
+}
+
+type reportInput struct {
+	Id int64
+}
+
+func reportController(t *reportInput) (report, error) {
+	return report{Name: "report " + strconv.FormatInt(t.Id, 10)}, nil
+}
+
+func TestEncodingExtension(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/report", reportController)
+	RegisterRoute("GET", "/v1/reports/{id}", reportController)
+	RegisterRoute("GET", "/v1/report/get", reportController)
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/v1/report", 200, JSON, `{"name":"report 0"}`},
+		{"/v1/report.json", 200, JSON, `{"name":"report 0"}`},
+		{"/v1/report.xml", 200, XML, `<report><name>report 0</name></report>`},
+		{"/v1/report.foo", 406, "", ""},
+		{"/v1/reports/5.xml", 200, XML, `<report><name>report 5</name></report>`},
+		{"/v1/report/get/id/5.json", 200, JSON, `{"name":"report 5"}`},
+	}
+	for _, tt := range tests {
+		w := do("GET", tt.path, "")
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.body != "" && (w.Body.String() != tt.body || w.Header().Get("Content-Type") != tt.contentType) {
+			t.Errorf("%s: got %q %s", tt.path, w.Header().Get("Content-Type"), w.Body)
+		}
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	Reset()
+	csv := Encoder{ContentType: "text/csv", Marshal: func(v interface{}) ([]byte, error) {
+		return []byte("name\n" + v.(report).Name + "\n"), nil
+	}}
+	if err := RegisterEncoder("csv", csv); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterEncoder("csv", csv); err == nil {
+		t.Fatal("expected an error registering csv twice")
+	}
+	RegisterRoute("GET", "/v1/report", reportController)
+	if w := do("GET", "/v1/report.csv", ""); w.Body.String() != "name\nreport 0\n" {
+		t.Fatalf("got %s", w.Body)
+	}
+	Reset()
+	if err := RegisterEncoder("csv", csv); err != nil {
+		t.Fatalf("Reset kept the csv encoder: %v", err)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	Reset()
+	RegisterEncoder("csv", Encoder{ContentType: "text/csv", Marshal: func(v interface{}) ([]byte, error) {
+		return []byte("name\n"), nil
+	}})
+	RegisterRoute("GET", "/v1/report", reportController)
+	if w := do("GET", "/v1/report.csv", ""); len(w.Header()["Content-Type"]) != 1 || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("got %q", w.Header()["Content-Type"])
+	}
+	for _, path := range []string{"/v1/missing", "/v1/report/id"} {
+		if w := do("GET", path, ""); w.Header().Get("Content-Type") == JSON {
+			t.Errorf("%s: got a json content type on an error", path)
+		}
+	}
+}
+
+type envelope struct {
+	OK   bool        `json:"ok"`
+	Data interface{} `json:"data"`
+}
+
+func TestResponseTransformer(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/reports/{id}", reportController)
+	RegisterRoute("GET", "/v1/reports/missing", func(t *reportInput) (report, error) { return report{}, ErrNotFound })
+	SetResponseTransformer(func(r *http.Request, v interface{}) interface{} {
+		if strings.HasSuffix(r.URL.Path, ".xml") {
+			return v
+		}
+		return envelope{OK: true, Data: v}
+	})
+	if w := do("GET", "/v1/reports/5", ""); w.Code != 200 || w.Body.String() != `{"ok":true,"data":{"name":"report 5"}}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/v1/reports/5.xml", ""); w.Code != 200 || w.Body.String() != `<report><name>report 5</name></report>` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/v1/reports/missing", ""); w.Code != 404 || strings.Contains(w.Body.String(), "ok") {
+		t.Fatalf("got %d %s for an error", w.Code, w.Body)
+	}
+}
+
+func TestMapKeyOrder(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/report/totals", func(t *reportInput) (map[string]interface{}, error) {
+		m := make(map[string]interface{})
+		for _, k := range []string{"zeta", "alpha", "mid", "beta", "omega", "gamma"} {
+			m[k] = map[string]int{"z": 1, "a": 2}
+		}
+		return m, nil
+	})
+	first := do("GET", "/v1/report/totals", "").Body.String()
+	for i := 0; i < 20; i++ {
+		if got := do("GET", "/v1/report/totals", "").Body.String(); got != first {
+			t.Fatalf("got %s, then %s", first, got)
+		}
+	}
+	if !strings.HasPrefix(first, `{"alpha":{"a":2,"z":1},"beta"`) {
+		t.Fatalf("got %s", first)
+	}
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// HTTPError is returned by a controller or a filter to respond
+// with its status and a json body of its message and details,
+// rather than the generic 500.
+// Example:
+//      func SaveUser(t *User) (string, error) {
+//          return "", router.HTTPError{
+//              Status:  422,
+//              Message: "invalid",
+//              Details: map[string]string{"email": "taken"},
+//          }
+//      }
+//
+type HTTPError struct {
+	Status  int         `json:"status"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func (e HTTPError) Error() string {
+	return e.Message
+}
+
+// Get the HTTPError of an error, returned either as a value or a pointer.
+func asHTTPError(err error) (HTTPError, bool) {
+	var e HTTPError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	var p *HTTPError
+	if errors.As(err, &p) && p != nil {
+		return *p, true
+	}
+	return e, false
+}
+
+// Respond with an HTTPError.
+// A zero status is a 500, an empty message the status text.
+// Routes with bare errors get no body for a 401, 403 or 404.
+func writeHTTPError(w http.ResponseWriter, r *http.Request, e HTTPError) {
+	if e.Status == 0 {
+		e.Status = http.StatusInternalServerError
+	}
+	if bareError(w, r, e.Status) {
+		return
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(e.Status)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		Logger.Printf("%s %s: can not marshal the error details: %v", r.Method, r.URL.Path, err)
+		e.Details = nil
+		data, _ = json.Marshal(e)
+	}
+	w.Header().Set("Content-Type", JSON)
+	w.WriteHeader(e.Status)
+	w.Write(data)
+}
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/users/save", func(t *testInput) (string, error) {
+		return "", HTTPError{Status: 422, Message: "invalid", Details: map[string]string{"email": "taken"}}
+	})
+	RegisterRoute("POST", "/v1/users/conflict", func(t *testInput) (string, error) {
+		return "", &HTTPError{Status: http.StatusConflict}
+	})
+	w := do("POST", "/v1/users/save", `{}`)
+	if w.Code != 422 || w.Header().Get("Content-Type") != JSON {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Body.String() != `{"status":422,"message":"invalid","details":{"email":"taken"}}` {
+		t.Fatalf("got %s", w.Body)
+	}
+	w = do("POST", "/v1/users/conflict", `{}`)
+	if w.Code != 409 || w.Body.String() != `{"status":409,"message":"Conflict"}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
+
+// Rejects every request with a 403.
+type forbidFilter struct{}
+
+func (f forbidFilter) Name() string {
+	return "forbid"
+}
+
+func (f forbidFilter) PreDispatch(r *http.Request, req Request) error {
+	return HTTPError{Status: http.StatusForbidden, Message: "forbidden"}
+}
+
+func (f forbidFilter) PostDispatch(r *http.Request, req Request) error {
+	return nil
+}
+
+func TestFilterHTTPError(t *testing.T) {
+	Reset()
+	RegisterFilter("forbid", forbidFilter{})
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	if w := do("GET", "/v1/test/retrieve", ""); w.Code != 403 || w.Body.String() != `{"status":403,"message":"forbidden"}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestBareErrors(t *testing.T) {
+	Reset()
+	missing := func(t *testInput) (string, error) { return "", ErrNotFound }
+	RegisterRoute("GET", "/v1/admin/{id}", missing, WithBareErrors())
+	RegisterRoute("GET", "/v1/vault/{id}", func(t *testInput) (string, error) {
+		return "", HTTPError{Status: 403, Message: "no access"}
+	}, WithBareErrors())
+	RegisterRoute("GET", "/v1/conflict/{id}", func(t *testInput) (string, error) {
+		return "", HTTPError{Status: 409, Message: "taken"}
+	}, WithBareErrors())
+	RegisterRoute("GET", "/v1/users/{id}", func(t *testInput) (string, error) {
+		return "", HTTPError{Status: 404, Message: "no such user"}
+	})
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/v1/admin/4", 404, ""},
+		{"/v1/vault/4", 403, ""},
+		{"/v1/conflict/4", 409, `{"status":409,"message":"taken"}`},
+		{"/v1/users/4", 404, `{"status":404,"message":"no such user"}`},
+	}
+	for _, tt := range tests {
+		if w := do("GET", tt.path, ""); w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, w.Code, w.Body, tt.code, tt.body)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header reporting the scheme a proxy received a request with.
+const ForwardedProtoHeader = "X-Forwarded-Proto"
+
+// Trust the X-Forwarded-Proto header set by a proxy terminating tls,
+// and the X-Forwarded-For and X-Real-Ip headers read by ClientIP.
+// Only turn it on behind a proxy that overwrites the headers, clients
+// can set them otherwise. SetTrustedProxies limits the peers trusted.
+var TrustProxyHeaders = false
+
+var (
+	// redirect plain http requests to https.
+	httpsOnly bool
+	// max age of the Strict-Transport-Security header.
+	hstsMaxAge time.Duration
+)
+
+// Redirect plain http requests to https and set the
+// Strict-Transport-Security header on https responses.
+// GET and HEAD requests are moved with a 301, other methods with
+// a 308 so the method and body are kept. A zero max age sets no header.
+//
+//  Usage:
+//
+//      go_router.TrustProxyHeaders = true
+//      go_router.EnableHTTPS(365 * 24 * time.Hour)
+//
+func EnableHTTPS(maxAge time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	httpsOnly, hstsMaxAge = true, maxAge
+}
+
+// Check if a request was received over https, either directly
+// or by a trusted proxy.
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return trustedPeer(r) && strings.EqualFold(r.Header.Get(ForwardedProtoHeader), "https")
+}
+
+// Redirect a plain http request to https, or set the
+// Strict-Transport-Security header of an https response.
+// Returns true when the request was redirected.
+func enforceHTTPS(w http.ResponseWriter, r *http.Request) bool {
+	mu.RLock()
+	enabled, maxAge := httpsOnly, hstsMaxAge
+	mu.RUnlock()
+	if !enabled {
+		return false
+	}
+	if isHTTPS(r) {
+		if maxAge > 0 {
+			w.Header().Set("Strict-Transport-Security", "max-age="+strconv.FormatInt(int64(maxAge/time.Second), 10))
+		}
+		return false
+	}
+	status := http.StatusPermanentRedirect
+	if r.Method == "GET" || r.Method == "HEAD" {
+		status = http.StatusMovedPermanently
+	}
+	u := *r.URL
+	u.Scheme, u.Host = "https", r.Host
+	http.Redirect(w, r, u.String(), status)
+	return true
+}
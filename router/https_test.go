@@ -0,0 +1,44 @@
+package router
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEnableHTTPS(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	EnableHTTPS(time.Hour)
+	w := do("GET", "/v1/users/4?x=1", "")
+	if w.Code != 301 || w.Header().Get("Location") != "https://example.com/v1/users/4?x=1" {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := do("POST", "/v1/users/4", "{}"); w.Code != 308 {
+		t.Fatalf("got %d for a POST", w.Code)
+	}
+
+	r := httptest.NewRequest("GET", "/v1/users/4", nil)
+	r.TLS = &tls.ConnectionState{}
+	w = serve(r)
+	if w.Code != 200 || w.Header().Get("Strict-Transport-Security") != "max-age=3600" {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Strict-Transport-Security"))
+	}
+}
+
+func TestTrustProxyHeaders(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	EnableHTTPS(time.Hour)
+	r := httptest.NewRequest("GET", "/v1/users/4", nil)
+	r.Header.Set(ForwardedProtoHeader, "https")
+	if w := serve(r); w.Code != 301 {
+		t.Fatalf("got %d with an untrusted header", w.Code)
+	}
+	defer func() { TrustProxyHeaders = false }()
+	TrustProxyHeaders = true
+	if w := serve(r); w.Code != 200 || w.Header().Get("Strict-Transport-Security") == "" {
+		t.Fatalf("got %d behind a trusted proxy", w.Code)
+	}
+}
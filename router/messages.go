@@ -0,0 +1,120 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keys of the built-in error messages, for RegisterMessages.
+const (
+	MsgNotFound             = "not_found"
+	MsgBadRequest           = "bad_request"
+	MsgMethodNotSupported   = "method_not_supported"
+	MsgNotAcceptable        = "not_acceptable"
+	MsgTimeout              = "timeout"
+	MsgUnavailable          = "unavailable"
+	MsgUnauthorized         = "unauthorized"
+	MsgTooLarge             = "too_large"
+	MsgUnsupportedMediaType = "unsupported_media_type"
+	MsgInternalError        = "internal_error"
+)
+
+// Language of the default messages, used when the
+// Accept-Language of a request matches no catalog.
+const defaultLanguage = "en"
+
+// message catalogs by language, guarded by mu.
+var messages = defaultMessages()
+
+// Get the catalog every router starts with.
+func defaultMessages() map[string]map[string]string {
+	return map[string]map[string]string{
+		defaultLanguage: {
+			MsgNotFound:             "Resource Not Found.",
+			MsgBadRequest:           "Bad Request.",
+			MsgMethodNotSupported:   "Request Method  is not supported.",
+			MsgNotAcceptable:        "Encoding Not Acceptable.",
+			MsgTimeout:              "Request Timeout.",
+			MsgUnavailable:          "Service Unavailable.",
+			MsgUnauthorized:         "Unauthorized.",
+			MsgTooLarge:             "Request Entity Too Large.",
+			MsgUnsupportedMediaType: "Unsupported Media Type.",
+			MsgInternalError:        "Internal Server Error.",
+		},
+	}
+}
+
+// Get the languages of an Accept-Language header, best first.
+func acceptLanguages(header string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+	var langs []lang
+	for _, v := range strings.Split(header, ",") {
+		parts := strings.Split(strings.TrimSpace(v), ";")
+		l := lang{tag: strings.ToLower(strings.TrimSpace(parts[0])), q: 1}
+		for _, p := range parts[1:] {
+			if q := strings.TrimSpace(p); strings.HasPrefix(q, "q=") {
+				l.q, _ = strconv.ParseFloat(q[2:], 64)
+			}
+		}
+		if l.tag != "" && l.tag != "*" && l.q > 0 {
+			langs = append(langs, l)
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	tags := make([]string, len(langs))
+	for i, v := range langs {
+		tags[i] = v.tag
+	}
+	return tags
+}
+
+// Get a built-in message in the best language for the request.
+// A language such as es-MX falls back to es, then to english.
+func message(r *http.Request, key string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, tag := range acceptLanguages(r.Header.Get("Accept-Language")) {
+		if m, ok := messages[tag][key]; ok {
+			return m
+		}
+		if i := strings.Index(tag, "-"); i > 0 {
+			if m, ok := messages[tag[:i]][key]; ok {
+				return m
+			}
+		}
+	}
+	return messages[defaultLanguage][key]
+}
+
+// Write a built-in error message.
+func writeMessage(w http.ResponseWriter, r *http.Request, status int, key string) {
+	w.WriteHeader(status)
+	w.Write([]byte(message(r, key) + "\n"))
+}
+
+// Register translations of the built-in error messages for a language,
+// picked by the Accept-Language of a request. Keys missing from the
+// translation fall back to english.
+//
+//  Usage:
+//
+//      go_router.RegisterMessages("es", map[string]string{
+//          go_router.MsgNotFound: "Recurso no encontrado.",
+//      })
+//
+func RegisterMessages(lang string, m map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+	lang = strings.ToLower(lang)
+	if messages[lang] == nil {
+		messages[lang] = make(map[string]string)
+	}
+	for k, v := range m {
+		messages[lang][k] = v
+	}
+}
@@ -0,0 +1,39 @@
+package router
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestLocalizedMessages(t *testing.T) {
+	Reset()
+	RegisterMessages("es", map[string]string{MsgNotFound: "Recurso no encontrado."})
+	tests := map[string]string{
+		"es":                 "Recurso no encontrado.\n",
+		"es-MX":              "Recurso no encontrado.\n",
+		"fr, es;q=0.8":       "Recurso no encontrado.\n",
+		"en;q=0.5, es;q=0.9": "Recurso no encontrado.\n",
+		"fr":                 "Resource Not Found.\n",
+		"":                   "Resource Not Found.\n",
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest("GET", "/v1/missing/route", nil)
+		r.Header.Set("Accept-Language", header)
+		if w := serve(r); w.Code != 404 || w.Body.String() != want {
+			t.Errorf("%q: got %d %q, want %q", header, w.Code, w.Body, want)
+		}
+	}
+	r := httptest.NewRequest("GET", "/v1", nil)
+	r.Header.Set("Accept-Language", "es")
+	if w := serve(r); w.Body.String() != "Bad Request.\n" {
+		t.Errorf("got %q, a missing translation should fall back to english", w.Body)
+	}
+}
+
+func TestAcceptLanguages(t *testing.T) {
+	got := acceptLanguages("da, en-GB;q=0.8, *;q=0.5, fr;q=0")
+	if want := []string{"da", "en-gb"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
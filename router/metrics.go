@@ -0,0 +1,38 @@
+package router
+
+import (
+	"net/http"
+	"time"
+)
+
+// MetricsCollector observes every dispatched request, so request counts
+// and latencies can be exported, as to Prometheus.
+// The path is the route the request matched, as /v1/users/{id}, which
+// keeps the labels few. It is empty for requests matching no route.
+//
+//  Usage:
+//
+//      go_router.Metrics = promCollector{requests, latency}
+//
+type MetricsCollector interface {
+	ObserveRequest(method string, path string, status int, d time.Duration)
+}
+
+// Collector of the dispatched requests, observing nothing by default.
+var Metrics MetricsCollector = nopCollector{}
+
+type nopCollector struct{}
+
+func (nopCollector) ObserveRequest(method string, path string, status int, d time.Duration) {}
+
+// Observe a dispatched request with Metrics.
+func observe(r *http.Request, rt *route, status int, d time.Duration) {
+	if Metrics == nil {
+		return
+	}
+	path := ""
+	if rt != nil {
+		path = rt.path
+	}
+	Metrics.ObserveRequest(r.Method, path, status, d)
+}
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type observation struct {
+	method string
+	path   string
+	status int
+}
+
+// Records the requests it observes.
+type fakeCollector struct {
+	mu   sync.Mutex
+	seen []observation
+}
+
+func (c *fakeCollector) ObserveRequest(method string, path string, status int, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen = append(c.seen, observation{method, path, status})
+}
+
+func TestMetrics(t *testing.T) {
+	Reset()
+	c := &fakeCollector{}
+	defer func() { Metrics = nopCollector{} }()
+	Metrics = c
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	RegisterRoute("DELETE", "/v1/users/{id}", func(t *testInput) (string, error) { return "", ErrNotFound })
+	do("GET", "/v1/users/4", "")
+	do("DELETE", "/v1/users/4", "")
+	do("GET", "/v1/nothing/here/at/all", "")
+	want := []observation{
+		{"GET", "/v1/users/{id}", 200},
+		{"DELETE", "/v1/users/{id}", 404},
+		{"GET", "", 404},
+	}
+	if len(c.seen) != len(want) {
+		t.Fatalf("got %+v", c.seen)
+	}
+	for i, o := range c.seen {
+		if o != want[i] {
+			t.Errorf("got %+v, want %+v", o, want[i])
+		}
+	}
+}
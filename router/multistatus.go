@@ -0,0 +1,37 @@
+package router
+
+type (
+	// MultiStatus is returned by a batch controller whose items succeed
+	// or fail on their own, so the batch is answered with a 207 and the
+	// result of each item rather than failing as a whole.
+	// Example:
+	//      func SaveUsers(t *UserBatch) (router.MultiStatus, error) {
+	//          var m router.MultiStatus
+	//          for _, u := range t.Users {
+	//              if err := users.Save(u); err != nil {
+	//                  m.Results = append(m.Results, router.ItemResult{Status: 400, Error: err.Error()})
+	//                  continue
+	//              }
+	//              m.Results = append(m.Results, router.ItemResult{Status: 201, Data: u})
+	//          }
+	//          return m, nil
+	//      }
+	//
+	MultiStatus struct {
+		Results []ItemResult `json:"results"`
+	}
+	// ItemResult is the outcome of one item of a batch.
+	ItemResult struct {
+		Status int         `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+		Error  string      `json:"error,omitempty"`
+	}
+)
+
+// Always list the results, even when there are none.
+func (m MultiStatus) withResults() MultiStatus {
+	if m.Results == nil {
+		m.Results = []ItemResult{}
+	}
+	return m
+}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"testing"
+)
+
+func TestMultiStatus(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/users/save", func(t *testInput) (MultiStatus, error) {
+		return MultiStatus{Results: []ItemResult{
+			{Status: 201, Data: map[string]int64{"id": 1}},
+			{Status: 400, Error: "Name is required"},
+		}}, nil
+	})
+	RegisterRoute("POST", "/v1/users/none", func(t *testInput) (*MultiStatus, error) {
+		return &MultiStatus{}, nil
+	})
+	w := do("POST", "/v1/users/save", "{}")
+	want := `{"results":[{"status":201,"data":{"id":1}},{"status":400,"error":"Name is required"}]}`
+	if w.Code != 207 || w.Body.String() != want || w.Header().Get("Content-Type") != JSON {
+		t.Fatalf("got %d %s %q", w.Code, w.Body, w.Header().Get("Content-Type"))
+	}
+	if w := do("POST", "/v1/users/none", "{}"); w.Code != 207 || w.Body.String() != `{"results":[]}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
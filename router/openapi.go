@@ -0,0 +1,225 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+const (
+	openAPIVersion = "3.0.3"
+	openAPITitle   = "go_router API"
+	apiVersion     = "1.0.0"
+)
+
+type (
+	openAPISpec struct {
+		OpenAPI string                       `json:"openapi"`
+		Info    openAPIInfo                  `json:"info"`
+		Paths   map[string]openAPIOperations `json:"paths"`
+	}
+	openAPIInfo struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+	openAPIOperations map[string]openAPIOperation
+	openAPIOperation  struct {
+		Summary     string                     `json:"summary,omitempty"`
+		Tags        []string                   `json:"tags,omitempty"`
+		Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+		RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+		Responses   map[string]openAPIResponse `json:"responses"`
+	}
+	openAPIParameter struct {
+		Name     string        `json:"name"`
+		In       string        `json:"in"`
+		Required bool          `json:"required"`
+		Schema   openAPISchema `json:"schema"`
+	}
+	openAPIRequestBody struct {
+		Content map[string]openAPIMediaType `json:"content"`
+	}
+	openAPIResponse struct {
+		Description string                      `json:"description"`
+		Content     map[string]openAPIMediaType `json:"content,omitempty"`
+	}
+	openAPIMediaType struct {
+		Schema openAPISchema `json:"schema"`
+	}
+	openAPISchema struct {
+		Type       string                   `json:"type,omitempty"`
+		Format     string                   `json:"format,omitempty"`
+		Properties map[string]openAPISchema `json:"properties,omitempty"`
+	}
+)
+
+// Get the schema of a controller input field.
+// Returns false for kinds setInputParam can not bind.
+func fieldSchema(t reflect.Type) (openAPISchema, bool) {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) || t == durationType {
+		return openAPISchema{Type: "string"}, true
+	}
+	switch t.Kind() {
+	case reflect.Int64:
+		return openAPISchema{Type: "integer", Format: "int64"}, true
+	case reflect.Float64:
+		return openAPISchema{Type: "number", Format: "double"}, true
+	case reflect.Bool:
+		return openAPISchema{Type: "boolean"}, true
+	case reflect.String:
+		return openAPISchema{Type: "string"}, true
+	}
+	return openAPISchema{}, false
+}
+
+// Get the name a field is documented under,
+// its first alias when it has any.
+func paramName(f reflect.StructField) string {
+	if tag, ok := f.Tag.Lookup("param"); ok {
+		return strings.Split(tag, ",")[0]
+	}
+	return lowerFirst(f.Name)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Get the input struct of a controller.
+// Errors unless the controller returns a value and an error.
+func inputType(n Node) (reflect.Type, error) {
+	t := reflect.TypeOf(n)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() < 1 || t.NumIn() > 3 ||
+		(t.NumIn() == 2 && t.In(0) != contextType) ||
+		(t.NumIn() == 3 && (t.In(0) != responseWriterType || t.In(1) != requestType)) {
+		return nil, errors.New("Controller must take a pointer to a struct")
+	}
+	p := t.In(t.NumIn() - 1)
+	if p.Kind() != reflect.Ptr || p.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("Controller must take a pointer to a struct")
+	}
+	if t.NumOut() != 2 || !t.Out(1).Implements(errorType) {
+		return nil, errors.New("Controller must return a value and an error")
+	}
+	return p.Elem(), nil
+}
+
+// Build the operation of a single route.
+// GET and DELETE params are described as path segments in the
+// form /param-name/{param-name}, POST, PUT and PATCH params
+// as a json body.
+// Params of a route pattern are described by its segments.
+// The field taking the rest of the path is not described.
+func openAPIPath(method string, path string, segments []segment, rt *route) (string, openAPIOperation, error) {
+	op := openAPIOperation{
+		Summary: rt.meta.Summary,
+		Tags:    rt.meta.Tags,
+		Responses: map[string]openAPIResponse{
+			"200": {
+				Description: "OK",
+				Content:     map[string]openAPIMediaType{JSON: {}},
+			},
+		},
+	}
+	t, err := inputType(rt.node)
+	if err != nil {
+		return path, op, err
+	}
+	bound := make(map[string]bool)
+	if segments != nil {
+		path = ""
+		for _, v := range segments {
+			if v.kind == literalSegment {
+				path += "/" + v.value
+				continue
+			}
+			path += "/{" + v.value + "}"
+			s := openAPISchema{Type: "string"}
+			if f, ok := paramField(t, v.value); ok {
+				bound[f.Name] = true
+				if fs, ok := fieldSchema(f.Type); ok {
+					s = fs
+				}
+			}
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:     v.value,
+				In:       "path",
+				Required: true,
+				Schema:   s,
+			})
+		}
+	}
+	body := openAPISchema{Type: "object", Properties: make(map[string]openAPISchema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		s, ok := fieldSchema(f.Type)
+		if f.PkgPath != "" || !ok || bound[f.Name] || f.Tag.Get("path") == "remainder" {
+			continue
+		}
+		name := paramName(f)
+		switch {
+		case hasBody(method):
+			body.Properties[name] = s
+		case segments == nil:
+			path += "/" + name + "/{" + name + "}"
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   s,
+			})
+		}
+	}
+	if hasBody(method) {
+		op.RequestBody = &openAPIRequestBody{
+			Content: map[string]openAPIMediaType{JSON: {Schema: body}},
+		}
+	}
+	return path, op, nil
+}
+
+// Add an operation to the spec.
+func (spec *openAPISpec) add(method string, path string, segments []segment, rt *route) error {
+	p, op, err := openAPIPath(method, path, segments, rt)
+	if err != nil {
+		return errors.New(method + " " + path + ": " + err.Error())
+	}
+	if _, ok := spec.Paths[p]; !ok {
+		spec.Paths[p] = make(openAPIOperations)
+	}
+	spec.Paths[p][strings.ToLower(method)] = op
+	return nil
+}
+
+// Export the registered routes as an OpenAPI 3 spec.
+// The parameters of each route are reflected from
+// the input struct of its controller, its summary and
+// tags come from its RouteMeta.
+//
+//  Usage:
+//
+//      spec, err := go_router.OpenAPI()
+//
+func OpenAPI() ([]byte, error) {
+	spec := openAPISpec{
+		OpenAPI: openAPIVersion,
+		Info:    openAPIInfo{Title: openAPITitle, Version: apiVersion},
+		Paths:   make(map[string]openAPIOperations),
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for method, nodes := range routes {
+		for path, rt := range nodes {
+			if err := spec.add(method, path, nil, rt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for method, v := range patterns {
+		for _, p := range v {
+			if err := spec.add(method, p.path, p.segments, p.route); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.Marshal(spec)
+}
@@ -0,0 +1,97 @@
+package router
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type openAPIInput struct {
+	Id     int64
+	Name   string
+	Active bool
+	hidden string
+}
+
+func openAPIController(t *openAPIInput) (string, error) {
+	return t.Name, nil
+}
+
+func TestOpenAPI(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", openAPIController)
+	RegisterRoute("POST", "/v1/test/save", openAPIController)
+	RegisterRoute("GET", "/v1/users/{id}", openAPIController)
+	b, err := OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec openAPISpec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	get, ok := spec.Paths["/v1/test/retrieve/id/{id}/name/{name}/active/{active}"]["get"]
+	if !ok {
+		t.Fatalf("missing GET operation in %s", b)
+	}
+	want := map[string]string{"id": "integer", "name": "string", "active": "boolean"}
+	if len(get.Parameters) != len(want) {
+		t.Fatalf("got %d params, want %d", len(get.Parameters), len(want))
+	}
+	for _, p := range get.Parameters {
+		if p.In != "path" || !p.Required || p.Schema.Type != want[p.Name] {
+			t.Errorf("got param %+v", p)
+		}
+	}
+
+	post, ok := spec.Paths["/v1/test/save"]["post"]
+	if !ok || post.RequestBody == nil {
+		t.Fatalf("missing POST request body in %s", b)
+	}
+	props := post.RequestBody.Content[JSON].Schema.Properties
+	if len(props) != len(want) || props["id"].Format != "int64" {
+		t.Fatalf("got body properties %+v", props)
+	}
+
+	pattern, ok := spec.Paths["/v1/users/{id}"]["get"]
+	if !ok || len(pattern.Parameters) != 1 || pattern.Parameters[0].Schema.Type != "integer" {
+		t.Fatalf("got pattern operation %+v", pattern)
+	}
+}
+
+func TestOpenAPIInvalidController(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/bad", func(s string) (string, error) { return s, nil })
+	if _, err := OpenAPI(); err == nil {
+		t.Fatal("expected an error for a controller without an input struct")
+	}
+}
+
+func TestOpenAPIRemainder(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/proxy/fetch", func(t *proxyInput) (string, error) { return t.Rest, nil })
+	b, err := OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec openAPISpec
+	json.Unmarshal(b, &spec)
+	if _, ok := spec.Paths["/v1/proxy/fetch/query/{query}"]["get"]; !ok {
+		t.Fatalf("got %s", b)
+	}
+}
+
+func TestOpenAPIMeta(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", openAPIController, WithMeta(RouteMeta{Summary: "Get a user", Tags: []string{"users"}}))
+	b, err := OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec openAPISpec
+	json.Unmarshal(b, &spec)
+	op := spec.Paths["/v1/users/{id}"]["get"]
+	if op.Summary != "Get a user" || len(op.Tags) != 1 || op.Tags[0] != "users" {
+		t.Fatalf("got %s", b)
+	}
+}
@@ -0,0 +1,35 @@
+package router
+
+type (
+	// Page is returned by a controller listing a page of results,
+	// so every list endpoint responds with the same envelope.
+	// Page and PerPage echo the page and per_page request params
+	// when the controller leaves them unset.
+	// Example:
+	//      func ListUsers(t *UserQuery) (router.Page, error) {
+	//          users, total := users.List(t.Page, t.PerPage)
+	//          return router.Page{Data: users, Total: total}, nil
+	//      }
+	//
+	Page struct {
+		Data    interface{} `json:"data"`
+		Total   int64       `json:"total"`
+		Page    int64       `json:"page"`
+		PerPage int64       `json:"per_page"`
+	}
+)
+
+// Echo the paging params of a request in the page.
+func (p Page) withParams(req Request) Page {
+	if v, ok := req["page"]; ok && p.Page == 0 {
+		if n, err := v.int(); err == nil {
+			p.Page = n
+		}
+	}
+	if v, ok := req["per_page"]; ok && p.PerPage == 0 {
+		if n, err := v.int(); err == nil {
+			p.PerPage = n
+		}
+	}
+	return p
+}
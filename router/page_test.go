@@ -0,0 +1,23 @@
+package router
+
+import (
+	"testing"
+)
+
+func TestPage(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/list", func(t *testInput) (Page, error) {
+		return Page{Data: []string{"a", "b"}, Total: 10}, nil
+	})
+	RegisterRoute("GET", "/v1/users/first", func(t *testInput) (*Page, error) {
+		return &Page{Data: []string{"a"}, Total: 10, Page: 1, PerPage: 1}, nil
+	})
+	w := do("GET", "/v1/users/list?page=2&per_page=2", "")
+	if w.Code != 200 || w.Body.String() != `{"data":["a","b"],"total":10,"page":2,"per_page":2}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	w = do("GET", "/v1/users/first?page=2&per_page=2", "")
+	if w.Code != 200 || w.Body.String() != `{"data":["a"],"total":10,"page":1,"per_page":1}` {
+		t.Fatalf("got %d %s, the controller values should win", w.Code, w.Body)
+	}
+}
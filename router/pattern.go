@@ -0,0 +1,306 @@
+package router
+
+import (
+	"errors"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Segment kinds in precedence order,
+// literals beat params beat catch-alls.
+const (
+	literalSegment segmentKind = iota
+	paramSegment
+	catchAllSegment
+)
+
+type (
+	segmentKind int
+	// A single segment of a route pattern.
+	// value is the literal or the param name, re
+	// the constraint of a param if it has one.
+	segment struct {
+		kind  segmentKind
+		value string
+		re    *regexp.Regexp
+	}
+	// A route registered with params in its path, for example
+	// /v1/users/{id} or /v1/files/{path...}
+	pattern struct {
+		path     string
+		segments []segment
+		// position of the pattern among those of its method.
+		seq int
+		*route
+	}
+	patternMap map[string][]*pattern
+	// A node of the tree indexing the patterns of a method by their
+	// segments, so a path is only matched against the patterns
+	// sharing its segments.
+	patternNode struct {
+		literals map[string]*patternNode
+		params   []*paramEdge
+		// patterns ending at the node, and ending with a
+		// catch-all right after it.
+		end      []*pattern
+		catchAll []*pattern
+	}
+	// The child of a node for a param, shared by params
+	// with the same regex.
+	paramEdge struct {
+		re   *regexp.Regexp
+		node *patternNode
+	}
+)
+
+var (
+	patterns = make(patternMap)
+	// the patterns of each method indexed by segment.
+	patternTrees = make(map[string]*patternNode)
+)
+
+// Check if a route path contains params.
+func isPattern(path string) bool {
+	return strings.Contains(path, "{")
+}
+
+// Split a url path into its segments.
+func splitPath(path string) []string {
+	s := strings.Split(html.EscapeString(strings.Trim(path, "/")), "/")
+	if len(s) == 1 && s[0] == "" {
+		return nil
+	}
+	return s
+}
+
+// Parse a route pattern into segments.
+// A catch-all is only allowed as the last segment, and
+// each param name only once. A param can be constrained by a
+// regex matching the whole segment, as in {id:[0-9]+}
+func parsePattern(path string) ([]segment, error) {
+	s := strings.Split(strings.Trim(path, "/"), "/")
+	segments := make([]segment, len(s))
+	names := make(map[string]bool)
+	for i, v := range s {
+		if !strings.HasPrefix(v, "{") || !strings.HasSuffix(v, "}") {
+			if strings.ContainsAny(v, "{}") {
+				return nil, errors.New("Invalid route pattern")
+			}
+			segments[i] = segment{kind: literalSegment, value: v}
+			continue
+		}
+		name := v[1 : len(v)-1]
+		var re *regexp.Regexp
+		if j := strings.Index(name, ":"); j >= 0 {
+			var err error
+			if re, err = regexp.Compile("^(?:" + name[j+1:] + ")$"); err != nil {
+				return nil, errors.New("Invalid route pattern param regex " + name[j+1:])
+			}
+			name = name[:j]
+		}
+		kind := paramSegment
+		if strings.HasSuffix(name, "...") {
+			if re != nil {
+				return nil, errors.New("Catch-all of a route pattern can not have a regex")
+			}
+			if i != len(s)-1 {
+				return nil, errors.New("Catch-all must be the last segment of a route pattern")
+			}
+			name = strings.TrimSuffix(name, "...")
+			kind = catchAllSegment
+		}
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, "{}") ||
+			(StrictParamNames && !identifier.MatchString(name)) {
+			return nil, errors.New("Invalid route pattern param " + name)
+		}
+		if names[name] {
+			return nil, errors.New("Duplicate route pattern param " + name)
+		}
+		names[name] = true
+		segments[i] = segment{kind: kind, value: name, re: re}
+	}
+	return segments, nil
+}
+
+// Get the regex of a param segment, empty when it has none.
+func (s segment) constraint() string {
+	if s.re == nil {
+		return ""
+	}
+	return s.re.String()
+}
+
+// Check if two patterns match exactly the same paths,
+// in which case precedence can not choose between them.
+func (p *pattern) ambiguous(o *pattern) bool {
+	if len(p.segments) != len(o.segments) {
+		return false
+	}
+	for i, s := range p.segments {
+		t := o.segments[i]
+		if s.kind != t.kind || (s.kind == literalSegment && s.value != t.value) {
+			return false
+		}
+		if s.kind == paramSegment && s.constraint() != t.constraint() {
+			return false
+		}
+	}
+	return true
+}
+
+// Match the url path segments against the pattern,
+// returning the bound params.
+func (p *pattern) match(s []string) (Request, bool) {
+	n := len(p.segments)
+	if len(s) < n || (len(s) > n && p.segments[n-1].kind != catchAllSegment) {
+		return nil, false
+	}
+	req := make(Request)
+	for i, seg := range p.segments {
+		switch seg.kind {
+		case literalSegment:
+			if s[i] != seg.value && !(CaseInsensitivePaths && strings.EqualFold(s[i], seg.value)) {
+				return nil, false
+			}
+		case paramSegment:
+			if seg.re != nil && !seg.re.MatchString(s[i]) {
+				return nil, false
+			}
+			req[seg.value] = &RequestParam{Value: s[i]}
+		case catchAllSegment:
+			req[seg.value] = &RequestParam{Value: strings.Join(s[i:], "/")}
+		}
+	}
+	return req, true
+}
+
+// Check if the pattern takes precedence over another matching pattern.
+// The first segment where the kinds differ, or where only one param
+// has a regex, decides.
+func (p *pattern) precedes(o *pattern) bool {
+	for i, s := range p.segments {
+		if i >= len(o.segments) {
+			return true
+		}
+		if s.kind != o.segments[i].kind {
+			return s.kind < o.segments[i].kind
+		}
+		// a constrained param beats one matching anything.
+		if s.kind == paramSegment && (s.re == nil) != (o.segments[i].re == nil) {
+			return s.re != nil
+		}
+	}
+	return false
+}
+
+// Register a route pattern.
+// Errors when the pattern is ambiguous with a pattern
+// already registered for the method.
+func registerPattern(method string, path string, rt *route) error {
+	segments, err := parsePattern(path)
+	if err != nil {
+		return err
+	}
+	p := &pattern{path: path, segments: segments, route: rt}
+	for _, v := range patterns[method] {
+		if p.ambiguous(v) {
+			return errors.New("Route pattern is ambiguous with " + v.path)
+		}
+	}
+	p.seq = len(patterns[method])
+	patterns[method] = append(patterns[method], p)
+	if patternTrees[method] == nil {
+		patternTrees[method] = &patternNode{}
+	}
+	patternTrees[method].insert(p)
+	return nil
+}
+
+// Index a pattern under the node.
+func (n *patternNode) insert(p *pattern) {
+	for _, seg := range p.segments {
+		switch seg.kind {
+		case literalSegment:
+			if n.literals == nil {
+				n.literals = make(map[string]*patternNode)
+			}
+			if n.literals[seg.value] == nil {
+				n.literals[seg.value] = &patternNode{}
+			}
+			n = n.literals[seg.value]
+		case paramSegment:
+			n = n.param(seg)
+		case catchAllSegment:
+			n.catchAll = append(n.catchAll, p)
+			return
+		}
+	}
+	n.end = append(n.end, p)
+}
+
+// Get the child of the node for a param segment.
+func (n *patternNode) param(seg segment) *patternNode {
+	for _, e := range n.params {
+		if (segment{re: e.re}).constraint() == seg.constraint() {
+			return e.node
+		}
+	}
+	e := &paramEdge{re: seg.re, node: &patternNode{}}
+	n.params = append(n.params, e)
+	return e.node
+}
+
+// Collect the patterns under the node matching the
+// url path segments from the i-th on.
+func (n *patternNode) collect(s []string, i int, found []*pattern) []*pattern {
+	if i == len(s) {
+		return append(found, n.end...)
+	}
+	found = append(found, n.catchAll...)
+	if CaseInsensitivePaths {
+		for k, child := range n.literals {
+			if strings.EqualFold(k, s[i]) {
+				found = child.collect(s, i+1, found)
+			}
+		}
+	} else if child, ok := n.literals[s[i]]; ok {
+		found = child.collect(s, i+1, found)
+	}
+	for _, e := range n.params {
+		if e.re == nil || e.re.MatchString(s[i]) {
+			found = e.node.collect(s, i+1, found)
+		}
+	}
+	return found
+}
+
+// Get the controller of the route pattern matching the url path.
+// The params bound by the pattern are added to the request.
+func getPatternNode(method string, path string, req Request) (*route, error) {
+	s := splitPath(path)
+	tree := patternTrees[method]
+	if tree == nil {
+		return nil, ErrNoHandler
+	}
+	// the matching patterns are compared in the order
+	// they were registered, the earliest winning a tie.
+	found := tree.collect(s, 0, nil)
+	sort.Slice(found, func(i, j int) bool { return found[i].seq < found[j].seq })
+	var best *pattern
+	for _, p := range found {
+		if best == nil || p.precedes(best) {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil, ErrNoHandler
+	}
+	params, _ := best.match(s)
+	for k, v := range params {
+		req[k] = v
+	}
+	return best.route, nil
+}
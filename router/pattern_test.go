@@ -0,0 +1,237 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPatternAmbiguity(t *testing.T) {
+	Reset()
+	if err := RegisterRoute("GET", "/v1/users/{id}", testController); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterRoute("GET", "/v1/users/{name}", testController); err == nil {
+		t.Fatal("expected /v1/users/{name} to be ambiguous with /v1/users/{id}")
+	}
+	if err := RegisterRoute("POST", "/v1/users/{name}", testController); err != nil {
+		t.Fatalf("patterns of other methods are not ambiguous: %v", err)
+	}
+	if err := RegisterRoute("GET", "/v1/users/{id}/posts", testController); err != nil {
+		t.Fatalf("patterns of other lengths are not ambiguous: %v", err)
+	}
+}
+
+func TestPatternPrecedence(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", func(t *testInput) (string, error) { return "param " + t.Id, nil })
+	RegisterRoute("GET", "/v1/users/me", func(t *testInput) (string, error) { return "literal", nil })
+	RegisterRoute("GET", "/v1/files/{name...}", func(t *testInput) (string, error) { return "catch-all " + t.Name, nil })
+	RegisterRoute("GET", "/v1/files/x/{id}", func(t *testInput) (string, error) { return "param " + t.Id, nil })
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/users/42", `"param 42"`},
+		{"/v1/users/me", `"literal"`},
+		{"/v1/files/a/b/c", `"catch-all a/b/c"`},
+		{"/v1/files/x/7", `"param 7"`},
+		{"/v1/files/x/7/8", `"catch-all x/7/8"`},
+	}
+	for _, tt := range tests {
+		w := do("GET", tt.path, "")
+		if w.Code != 200 || w.Body.String() != tt.want {
+			t.Errorf("%s: got %d %s, want %s", tt.path, w.Code, w.Body, tt.want)
+		}
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	Reset()
+	for _, path := range []string{"/v1/users/{id", "/v1/{path...}/x", "/v1/users/{}"} {
+		if err := RegisterRoute("GET", path, testController); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/get", func(t *testInput) (string, error) { return "get", nil })
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	tests := map[string]string{
+		"/v1//users/get":          `"get"`,
+		"/v1/users/./get":         `"get"`,
+		"/v1/admin/../users/get":  `"get"`,
+		"//v1/users/./../users/4": `"4"`,
+	}
+	for path, want := range tests {
+		if w := do("GET", path, ""); w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", path, w.Code, w.Body, want)
+		}
+	}
+	for _, path := range []string{"/../v1/users/get", "/v1/../../users/get"} {
+		if w := do("GET", path, ""); w.Code != 400 {
+			t.Errorf("%s: got %d, want 400", path, w.Code)
+		}
+	}
+}
+
+func TestRouteRewriter(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}/profile", func(t *testInput) (string, error) { return "profile " + t.Id, nil })
+	RegisterRoute("GET", "/v1/me/profile", func(t *testInput) (string, error) { return "me", nil })
+	SetRouteRewriter(func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/v1/me/") {
+			return "/v1/users/42/" + strings.TrimPrefix(r.URL.Path, "/v1/me/")
+		}
+		return ""
+	})
+	if w := do("GET", "/v1//me/profile", ""); w.Code != 200 || w.Body.String() != `"profile 42"` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/v1/users/7/profile", ""); w.Code != 200 || w.Body.String() != `"profile 7"` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	SetRouteRewriter(func(r *http.Request) string { return "/../etc" })
+	if w := do("GET", "/v1/me/profile", ""); w.Code != 400 {
+		t.Fatalf("got %d for a rewrite escaping the root", w.Code)
+	}
+}
+
+func TestPatternRegex(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id:[0-9]+}", func(t *testInput) (string, error) { return "id " + t.Id, nil })
+	RegisterRoute("GET", "/v1/users/{name}", func(t *testInput) (string, error) { return "name " + t.Name, nil })
+	RegisterRoute("GET", "/v1/codes/{id:[A-Z]{3}}", testController)
+	tests := map[string]string{
+		"/v1/users/42":  `"id 42"`,
+		"/v1/users/abc": `"name abc"`,
+		"/v1/users/4a":  `"name 4a"`,
+		"/v1/codes/ABC": `"ABC"`,
+	}
+	for path, want := range tests {
+		if w := do("GET", path, ""); w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", path, w.Code, w.Body, want)
+		}
+	}
+	if w := do("GET", "/v1/codes/ABCD", ""); w.Code == 200 {
+		t.Errorf("got %d %s for a segment the regex does not match", w.Code, w.Body)
+	}
+	if err := RegisterRoute("GET", "/v1/users/{uid:[0-9]+}", testController); err == nil {
+		t.Error("expected the same regex to be ambiguous")
+	}
+	for _, path := range []string{"/v1/items/{id:[0-9}", "/v1/files/{path...:.*}"} {
+		if err := RegisterRoute("GET", path, testController); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestCaseInsensitivePaths(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/get", testController)
+	RegisterRoute("GET", "/v1/users/{id}/profile", func(t *testInput) (string, error) { return t.Id, nil })
+	if w := do("GET", "/V1/Users/Get/id/Ab", ""); w.Code == 200 {
+		t.Fatalf("got %d with the option off", w.Code)
+	}
+	defer func() { CaseInsensitivePaths = false }()
+	CaseInsensitivePaths = true
+	tests := map[string]string{
+		"/V1/Users/Get/id/Ab":   `"Ab"`,
+		"/v1/users/get/id/Ab":   `"Ab"`,
+		"/V1/USERS/AbC/Profile": `"AbC"`,
+	}
+	for path, want := range tests {
+		if w := do("GET", path, ""); w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", path, w.Code, w.Body, want)
+		}
+	}
+	if err := RegisterRoute("GET", "/v1/Users/GET", testController); err == nil ||
+		err.Error() != "Route path differs only by case from /v1/users/get" {
+		t.Fatalf("got %v registering a path differing by case", err)
+	}
+	if w := do("GET", "/V1/Users/List", ""); w.Code != 404 {
+		t.Fatalf("got %d for an unknown path", w.Code)
+	}
+}
+
+func TestCaseCollision(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/get", func(t *testInput) (string, error) { return "lower", nil })
+	RegisterRoute("GET", "/v1/Users/Get", func(t *testInput) (string, error) { return "mixed", nil })
+	defer func() { CaseInsensitivePaths = false }()
+	CaseInsensitivePaths = true
+	for i := 0; i < 20; i++ {
+		if w := do("GET", "/V1/USERS/GET", ""); w.Code != 200 || w.Body.String() != `"lower"` {
+			t.Fatalf("got %d %s, want the first registered", w.Code, w.Body)
+		}
+	}
+	if w := do("GET", "/v1/Users/Get", ""); w.Body.String() != `"mixed"` {
+		t.Fatalf("got %s for an exact match", w.Body)
+	}
+}
+
+// Match a path the way the tree does, trying every pattern.
+func bruteForceMatch(method string, path string) *route {
+	s := splitPath(path)
+	var best *pattern
+	for _, p := range patterns[method] {
+		if _, ok := p.match(s); ok && (best == nil || p.precedes(best)) {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.route
+}
+
+// Register a few hundred patterns mixing literals, params,
+// regex params and catch-alls.
+func registerManyPatterns() {
+	for _, v := range []string{"v1", "v2", "V1"} {
+		for i := 0; i < 40; i++ {
+			res := "res" + strconv.Itoa(i)
+			RegisterRoute("GET", "/"+v+"/"+res+"/{id}", testController)
+			RegisterRoute("GET", "/"+v+"/"+res+"/{id:[0-9]+}/items", testController)
+			RegisterRoute("GET", "/"+v+"/"+res+"/me/items", testController)
+			RegisterRoute("GET", "/"+v+"/"+res+"/{id}/{name}", testController)
+			RegisterRoute("GET", "/"+v+"/{kind}/"+res+"/{name...}", testController)
+		}
+	}
+	RegisterRoute("GET", "/{path...}", testController)
+}
+
+func TestPatternTree(t *testing.T) {
+	Reset()
+	registerManyPatterns()
+	paths := []string{"/x"}
+	for _, v := range []string{"v1", "v2", "V1", "v3"} {
+		for _, res := range []string{"res0", "res7", "res39", "RES7", "res40"} {
+			for _, rest := range []string{"", "/42", "/abc", "/42/items", "/abc/items", "/me/items", "/42/x", "/a/b/c", "/me"} {
+				paths = append(paths, "/"+v+"/"+res+rest, "/"+v+"/thing/"+res+rest)
+			}
+		}
+	}
+	defer func() { CaseInsensitivePaths = false }()
+	for _, insensitive := range []bool{false, true} {
+		CaseInsensitivePaths = insensitive
+		for _, path := range paths {
+			got, _ := getPatternNode("GET", path, make(Request))
+			if want := bruteForceMatch("GET", path); got != want {
+				t.Errorf("%s (case insensitive %v): got %v, want %v", path, insensitive, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkPatternMatch(b *testing.B) {
+	Reset()
+	registerManyPatterns()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		getPatternNode("GET", "/v2/res39/42/items", make(Request))
+	}
+}
@@ -1,5 +1,5 @@
 // go_router is a simple rest based router.
-// The supported HTTP methods are GET, POST and DELETE.
+// The supported HTTP methods are GET, HEAD, POST, PUT, PATCH and DELETE.
 // The url path has to be in the form `/version/resource/handler/param-name/param-value`.
 //
 // Json is the supported response type.
@@ -9,30 +9,73 @@
 package router
 
 import (
+	"bytes"
+	"context"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html"
+	"io"
 	"io/ioutil"
+	"log"
+	"mime"
 	"net/http"
+	"os"
 	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
 
 const (
 	JSON = "application/json"
+	// Header identifying a request in the logs.
+	RequestIDHeader = "X-Request-Id"
+	// Header shortening the request deadline in debug mode, as in 50ms
+	DeadlineHeader = "X-Request-Deadline"
+	// Method of a route matching requests of every method.
+	// Routes registered for the request method take precedence.
+	ANY = "ANY"
+)
+
+// Param precedences.
+const (
+	// The first value sent wins.
+	FirstWins Precedence = iota
+	// The last value sent wins.
+	LastWins
+	// Values that differ are a bad request.
+	ErrorOnConflict
+)
+
+// Sources of request params.
+const (
+	pathParam paramSource = iota
+	bodyParam
+	queryParam
 )
 
 type (
-	nodeMap   map[string]Node
+	nodeMap   map[string]*route
 	routeMap  map[string]nodeMap
 	filterMap map[string]Filter
-	Request   map[string]*RequestParam
+	// Precedence resolves a param sent more than once.
+	Precedence int
+	// where a request param was found.
+	paramSource int
+	Request     map[string]*RequestParam
 	// Node is a controller function.
 	// The function should have a pointer to all required request parameters.
+	// It can also take a context.Context as its first parameter, which
+	// carries the values set by filters.
 	// Returns an interface and an error.
 	// Example:
 	//      type Test struct {
@@ -42,66 +85,555 @@ type (
 	//          fmt.Println(t)
 	//          return "user", nil
 	//      }
+	//      func GetProfile(ctx context.Context, t *Test) (string, error) {
+	//          return "profile", nil
+	//      }
+	// A controller can also take the response writer and the request
+	// to write the response itself, returning Handled.
+	//      func Export(w http.ResponseWriter, r *http.Request, t *Test) (interface{}, error) {
+	//          w.Write(report(t.Id))
+	//          return nil, router.Handled
+	//      }
 	//
 	Node interface{}
 	// Filters allow for pre and post dispatch work.
 	// For example verifying api key.
+	// PreDispatch runs before the params are bound to the controller,
+	// PostDispatch once its response is buffered.
+	// The Request is reused once the response is written, so a filter
+	// must copy the params it keeps.
 	Filter interface {
 		Name() string
 		PreDispatch(*http.Request, Request) error
 		PostDispatch(*http.Request, Request) error
 	}
-	RequestParam struct {
+	// PostDispatchResult is implemented by filters that need the outcome
+	// of the controller, such as metrics or a circuit breaker. Unlike
+	// PostDispatch it also runs when the controller failed.
+	PostDispatchResult interface {
+		PostDispatchResult(*http.Request, Request, Outcome) error
+	}
+	// Outcome of a controller call.
+	Outcome struct {
+		// status of the response.
+		Status int
+		// value returned by the controller.
 		Value interface{}
+		// error returned by the controller, or the context error
+		// when it timed out.
+		Err error
+	}
+	RequestParam struct {
+		Value  interface{}
+		source paramSource
+		// sent more than once with different values.
+		conflict bool
+		// every value sent, when sent more than once.
+		values []interface{}
+	}
+	// RouteOption configures a route when it is registered.
+	RouteOption func(*route)
+	// A registered controller along with its route options.
+	route struct {
+		method string
+		path   string
+		node   Node
+		// overrides RequestTimeout when set.
+		timeout time.Duration
+		// Cache-Control max-age of successful responses.
+		cacheMaxAge time.Duration
+		// param bound to the path after the handler segment.
+		remainder string
+		meta      RouteMeta
+		// write the response as it is produced.
+		unbuffered bool
+		// media type version of the route, and the versions
+		// of its path when it was registered first.
+		version  string
+		versions map[string]*route
+		// content types of the request bodies accepted, any when empty.
+		contentTypes []string
+		// respond to not found and unauthorized requests with no body.
+		bareErrors bool
+	}
+	// FieldError describes a param that could not be bound.
+	FieldError struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	}
+	// FieldErrors holds every param of a request that could not be bound.
+	FieldErrors []FieldError
+	// Body of the json error responses.
+	errorBody struct {
+		Error  string `json:"error"`
+		Detail string `json:"detail,omitempty"`
+	}
+	// A panic recovered from a controller running in its own goroutine.
+	controllerPanic struct {
+		value interface{}
+		stack []byte
 	}
 )
 
 var (
+	// guards the routes, patterns, filters, not found handlers,
+	// encoders, messages, param decoders, compressors, the response
+	// transformer, the route rewriter, the response callbacks, the https
+	// policy and the trusted proxies.
+	mu      sync.RWMutex
 	routes  = make(routeMap)
 	filters = make(filterMap)
+	// routes by lowercased path, for CaseInsensitivePaths.
+	foldedRoutes = make(routeMap)
+	// not found handlers by path prefix.
+	notFoundHandlers = make(map[string]http.HandlerFunc)
+	// transforms successful response values before they are marshaled.
+	responseTransformer func(r *http.Request, v interface{}) interface{}
+	// rewrites url paths before they are matched to a route.
+	routeRewriter func(r *http.Request) string
 )
 
+var (
+	// Log the full stack of a recovered panic and honor
+	// the X-Request-Deadline header.
+	// Only the panicking frames are logged when off.
+	DebugMode = false
+	// Logger for errors recovered during dispatch.
+	Logger = log.New(os.Stderr, "", log.LstdFlags)
+	// Deadline of the context of each request.
+	// Zero means requests never time out.
+	RequestTimeout time.Duration
+	// Time allowed to write a buffered response to the client, zero
+	// means no limit. It is the write deadline of the connection, kept
+	// until the response is sent, so the connection of a stalled client
+	// is closed. It is not enforced, and that is logged once, when the
+	// ResponseWriter does not support deadlines. Streams and unbuffered
+	// routes clear the deadline, so they are not bound by it, nor by
+	// http.Server.WriteTimeout while WriteTimeout is set.
+	WriteTimeout time.Duration
+	// Resolves a param sent more than once, whether repeated in one
+	// source or sent in several. Sources are ordered path, body then
+	// query, so the default FirstWins prefers path params.
+	ParamPrecedence = FirstWins
+	// Reject POST, PUT and PATCH requests whose Content-Type
+	// is not application/json with a 415.
+	RequireJSONContentType = false
+	// Respond 204 rather than 404 when a DELETE controller
+	// returns ErrNotFound, making deletes idempotent.
+	DeleteMissingIsOK = false
+	// Maximum size in bytes of a request body, which is kept in memory
+	// for BindJSON. Larger bodies are rejected with a 413, zero means
+	// no limit.
+	MaxBodySize int64 = 10 << 20
+	// Reject param names that are not identifiers, in url paths with a
+	// 400 and in route patterns when they are registered. Names are
+	// trimmed of spaces either way.
+	StrictParamNames = true
+	// Match url paths to routes ignoring case, so /V1/Users/Get is
+	// routed to /v1/users/get. Param values are bound as sent. While it
+	// is on, a path differing only by case from a registered one is
+	// rejected, otherwise the first of them registered is matched.
+	CaseInsensitivePaths = false
+	// Make Validate reject controllers whose result marshals to
+	// nothing useful, a struct with no exported fields, a func or a
+	// complex number, rather than leaving it to the first request.
+	StrictResponses = false
+	// Answer HEAD requests with the route registered for GET when
+	// there is none for HEAD. The controller runs as for GET and its
+	// body is dropped, keeping the headers and Content-Length.
+	AutoHead = true
+	// Maximum number of requests dispatched at once.
+	// Requests over the limit are shed with a 503, zero means no limit.
+	MaxConcurrent int
+	// Render the response to a panic or an unexpected controller error,
+	// which is the value recovered. It is logged with its stack by
+	// Logger either way, the default response is a plain 500.
+	PanicHandler func(w http.ResponseWriter, r *http.Request, err interface{})
+)
+
+var (
+	// guards the concurrent request semaphore.
+	semMu sync.Mutex
+	sem   chan struct{}
+)
+
+var (
+	// ErrMalformedPath is the error for a url path not in the form
+	// /version/resource/handler/param-name/param-value
+	ErrMalformedPath = errors.New("Malformed Path")
+	// ErrNoHandler is the error for a well formed url path
+	// that matches no route.
+	ErrNoHandler = errors.New("No Handler Found")
+	// ErrNotFound is returned by a controller when the
+	// requested resource does not exist.
+	ErrNotFound = errors.New("Not Found")
+	// ErrUnauthorized is returned by a filter to reject
+	// a request with a 401.
+	ErrUnauthorized = errors.New("Unauthorized")
+	// Handled is returned by a controller that wrote its own
+	// response, which Dispatch then leaves as it is.
+	Handled = errors.New("Handled")
+	// a field of a kind params can not be bound to.
+	errUnsupportedKind = errors.New("Unsupported field kind")
+)
+
+// Param names in a url path must be identifiers.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Number of frames kept in a trimmed stack.
+const trimmedFrames = 2
+
 // Get the controller associated with the incoming request.
-func getNode(method string, path string) (Node, error) {
+// With CaseInsensitivePaths a path differing only by case matches.
+func getNode(method string, path string) (*route, error) {
 	if nodes, ok := routes[method]; ok {
 		if v, ok := nodes[path]; ok {
 			return v, nil
 		}
+		if CaseInsensitivePaths {
+			if v, ok := foldedRoutes[method][strings.ToLower(path)]; ok {
+				return v, nil
+			}
+		}
+	}
+	return nil, ErrNoHandler
+}
+
+// Get the controller of a route taking the rest of the url path,
+// binding the path after /version/resource/handler to its param.
+// The rest is bound as sent, without escaping.
+func getRemainderNode(method string, path string, req Request) (*route, error) {
+	s := strings.SplitN(strings.Trim(path, "/"), "/", 4)
+	if len(s) < 3 {
+		return nil, ErrNoHandler
+	}
+	rt, err := getNode(method, "/"+html.EscapeString(strings.Join(s[:3], "/")))
+	if err != nil || rt.remainder == "" {
+		return nil, ErrNoHandler
+	}
+	rest := ""
+	if len(s) == 4 {
+		rest = s[3]
+	}
+	req[rt.remainder] = &RequestParam{Value: rest}
+	return rt, nil
+}
+
+// Get the canonical form of a url path, collapsing duplicate slashes
+// and resolving . and .. segments, so /v1//users/./get is /v1/users/get.
+// A trailing slash is kept. Errors with ErrMalformedPath when a ..
+// segment climbs above the root.
+func cleanPath(p string) (string, error) {
+	var s []string
+	for _, v := range strings.Split(p, "/") {
+		switch v {
+		case "", ".":
+		case "..":
+			if len(s) == 0 {
+				return p, ErrMalformedPath
+			}
+			s = s[:len(s)-1]
+		default:
+			s = append(s, v)
+		}
+	}
+	clean := "/" + strings.Join(s, "/")
+	if len(s) > 0 && strings.HasSuffix(p, "/") {
+		clean += "/"
+	}
+	return clean, nil
+}
+
+// Get the controller for a url path, trying the registered paths
+// before the route patterns. The params found in the path are
+// added to the request.
+// Errors with ErrMalformedPath when the path is not in the form
+// /version/resource/handler/param-name/param-value and matches
+// no pattern, and with ErrNoHandler otherwise.
+// The ANY routes are tried when no route of the method matches.
+func match(method string, path string, req Request) (*route, Request, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, params, err := matchMethod(method, path)
+	if err != nil && method == "HEAD" && AutoHead {
+		if v, p, e := matchMethod("GET", path); e == nil {
+			c, params, err = v, p, nil
+		}
+	}
+	if err != nil {
+		if v, p, e := matchMethod(ANY, path); e == nil {
+			c, params, err = v, p, nil
+		}
+	}
+	if err != nil {
+		return nil, req, err
+	}
+	for k, v := range params {
+		addParam(req, k, v)
+	}
+	return c, req, nil
+}
+
+// Get the controller for a url path among the routes registered
+// for a method, along with the params found in the path.
+func matchMethod(method string, path string) (*route, Request, error) {
+	params := make(Request)
+	var malformed error
+	c, err := getNode(method, path)
+	if err != nil {
+		c, err = getRemainderNode(method, path, params)
+	}
+	if err != nil {
+		// a malformed path can still match a route pattern.
+		var key string
+		key, malformed = parseGet(path, params)
+		c, err = getNode(method, key)
+	}
+	if err != nil {
+		params = make(Request)
+		c, err = getPatternNode(method, path, params)
+		if err != nil && malformed != nil {
+			return nil, nil, malformed
+		}
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	return nil, errors.New("No Handler Found")
+	return c, params, nil
+}
+
+// Get the not found handler of the longest prefix of a url path.
+func getNotFoundHandler(path string) (http.HandlerFunc, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	var h http.HandlerFunc
+	best := -1
+	for prefix, v := range notFoundHandlers {
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > best {
+			h, best = v, len(prefix)
+		}
+	}
+	return h, h != nil
 }
 
 // Respond to a request where the controller is not found.
 func notFound(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("Resource Not Found.\n"))
+	if bareError(w, r, http.StatusNotFound) {
+		return
+	}
+	if h, ok := getNotFoundHandler(r.URL.Path); ok {
+		h(w, r)
+		return
+	}
+	writeMessage(w, r, http.StatusNotFound, MsgNotFound)
+}
+
+// Respond to a malformed request.
+func badRequest(w http.ResponseWriter, r *http.Request) {
+	writeMessage(w, r, http.StatusBadRequest, MsgBadRequest)
+}
+
+// Respond to a request that matches no route.
+func noRoute(w http.ResponseWriter, r *http.Request, err error) {
+	if err == ErrMalformedPath {
+		badRequest(w, r)
+		return
+	}
+	notFound(w, r)
 }
 
 // Respond to an unsupported request method.
 func notSupported(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("Request Method  is not supported.\n"))
+	writeMessage(w, r, http.StatusNotFound, MsgMethodNotSupported)
+}
+
+// Respond to a request for an unknown encoding.
+func notAcceptable(w http.ResponseWriter, r *http.Request) {
+	writeMessage(w, r, http.StatusNotAcceptable, MsgNotAcceptable)
+}
+
+// Respond to a request with params that could not be bound.
+func badParams(w http.ResponseWriter, r *http.Request, errs FieldErrors) {
+	data, err := json.Marshal(errs)
+	if err != nil {
+		// log the error and panic
+		panic(err)
+	}
+	w.Header().Set("Content-Type", JSON)
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(data)
+}
+
+// Respond to a request that ran past its deadline.
+func timeout(w http.ResponseWriter, r *http.Request) {
+	writeMessage(w, r, http.StatusServiceUnavailable, MsgTimeout)
+}
+
+// Respond to a request shed because too many are in flight.
+func overloaded(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "1")
+	writeMessage(w, r, http.StatusServiceUnavailable, MsgUnavailable)
+}
+
+// Respond to a request rejected by a filter.
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	if bareError(w, r, http.StatusUnauthorized) {
+		return
+	}
+	writeMessage(w, r, http.StatusUnauthorized, MsgUnauthorized)
+}
+
+// Respond to a request with a body over MaxBodySize.
+func tooLarge(w http.ResponseWriter, r *http.Request) {
+	writeMessage(w, r, http.StatusRequestEntityTooLarge, MsgTooLarge)
+}
+
+// Check if reading the body failed on MaxBodySize.
+func isTooLarge(err error) bool {
+	var e *http.MaxBytesError
+	return errors.As(err, &e)
+}
+
+// Respond to a request with a body in an unsupported content type.
+func unsupportedMediaType(w http.ResponseWriter, r *http.Request) {
+	writeMessage(w, r, http.StatusUnsupportedMediaType, MsgUnsupportedMediaType)
+}
+
+// Respond to a controller result that can not be marshaled.
+// The error detail is only sent in debug mode.
+func marshalError(w http.ResponseWriter, r *http.Request, rt *route, err error) {
+	Logger.Printf("%s %s: can not marshal the response of %s: %v",
+		rt.method, rt.path, controllerName(rt.node), err)
+	body := errorBody{Error: "Internal Server Error"}
+	if DebugMode {
+		body.Detail = err.Error()
+	}
+	data, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", JSON)
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(data)
 }
 
 // Respond to a request when something goes wrong.
 func internalError(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte("Internal Server Error.\n"))
+	writeMessage(w, r, http.StatusInternalServerError, MsgInternalError)
+}
+
+// Get the function name of a controller.
+func controllerName(n Node) string {
+	v := reflect.ValueOf(n)
+	if v.Kind() != reflect.Func {
+		return v.Type().String()
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return v.Type().String()
+}
+
+// Trim a stack to the frames right below the panic.
+func trimStack(stack []byte) []byte {
+	lines := strings.Split(strings.TrimSpace(string(stack)), "\n")
+	start := 1
+	for i, l := range lines {
+		if strings.HasPrefix(l, "panic(") {
+			start = i + 2
+		}
+	}
+	if start >= len(lines) {
+		return stack
+	}
+	end := start + 2*trimmedFrames
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return []byte(strings.Join(append(lines[:1], lines[start:end]...), "\n"))
+}
+
+// Log a response that could not be written to the client,
+// along with its route and request id when there are any.
+func logWriteError(r *http.Request, rt *route, err error) {
+	where := r.Method + " " + r.URL.Path
+	if rt != nil {
+		where += " (" + rt.method + " " + rt.path + ")"
+	}
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		where += " request " + id
+	}
+	Logger.Printf("%s: can not write the response: %v", where, err)
+}
+
+// Log a recovered panic along with its stack.
+func logPanic(r *http.Request, err interface{}, stack []byte) {
+	if !DebugMode {
+		stack = trimStack(stack)
+	}
+	Logger.Printf("%s %s: %v\n%s", r.Method, r.URL.Path, err, stack)
+}
+
+// Respond to a recovered panic with PanicHandler.
+// A panicking handler is logged and the plain 500 written instead.
+func renderPanic(w *responseBuffer, r *http.Request, err interface{}) {
+	if PanicHandler == nil {
+		internalError(w, r)
+		return
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			logPanic(r, e, debug.Stack())
+			w.reset()
+			internalError(w, r)
+		}
+	}()
+	PanicHandler(w, r, err)
+}
+
+// Add a param to the request, resolving a param sent more than
+// once by ParamPrecedence. Params are added in the order path,
+// body then query.
+func addParam(req Request, name string, p *RequestParam) {
+	v, ok := req[name]
+	if !ok {
+		req[name] = p
+		return
+	}
+	values := append(v.sent(), p.Value)
+	switch ParamPrecedence {
+	case LastWins:
+		req[name] = p
+	case ErrorOnConflict:
+		if fmt.Sprint(v.Value) != fmt.Sprint(p.Value) {
+			v.conflict = true
+		}
+	}
+	req[name].values = values
 }
 
 // Parse the incoming request url for parameters.
 // supported url is in the form
 // /version/resource/handler/{param-name}/{param}
-func parseGet(r *http.Request, req Request) (string, error) {
+// unless the controller has a field tagged with `path:"remainder"`,
+// which is bound to everything after the handler segment instead.
+// With StrictParamNames param names must be identifiers,
+// so odd names never reach the field lookup.
+func parseGet(path string, req Request) (string, error) {
 	s := strings.Split(html.EscapeString(
-		strings.TrimRight(r.URL.Path, "/")), "/")
+		strings.TrimRight(path, "/")), "/")
 	l := len(s)
 	if l <= 3 || l%2 != 0 {
-		return "", errors.New("Not Found")
+		return "", ErrMalformedPath
 	}
 	for i := 4; i < l-1; i += 2 {
+		name := strings.TrimSpace(s[i])
+		if StrictParamNames && !identifier.MatchString(name) {
+			return "", ErrMalformedPath
+		}
 		t := RequestParam{Value: s[i+1]}
-		req[s[i]] = &t
+		addParam(req, name, &t)
 	}
 	return strings.Join(s[0:4], "/"), nil
 }
@@ -110,14 +642,17 @@ func parseGet(r *http.Request, req Request) (string, error) {
 // as well as post params.
 func parseForm(r *http.Request, req Request) Request {
 	for k, v := range r.Form {
-		t := RequestParam{Value: v[0]}
-		req[k] = &t
+		for _, value := range v {
+			t := RequestParam{Value: value, source: queryParam}
+			addParam(req, k, &t)
+		}
 	}
 	return req
 }
 
 // Parse the body for a json parameter. This is the
 // accepted way of posting a request.
+// The body is kept for BindJSON, Dispatch limits it to MaxBodySize.
 func parseBody(r *http.Request, req Request) (Request, error) {
 	var i map[string]interface{}
 	body, err := ioutil.ReadAll(r.Body)
@@ -125,20 +660,49 @@ func parseBody(r *http.Request, req Request) (Request, error) {
 		// log the error and panic
 		return req, err
 	}
+	setBody(r, body)
+	if len(bytes.TrimSpace(body)) == 0 {
+		// an empty body sends no params.
+		return req, nil
+	}
 	err = json.Unmarshal(body, &i)
 	if err != nil {
 		// log the error and panic
 		return req, err
 	}
 	for k, v := range i {
-		req[k] = &RequestParam{Value: v}
+		addParam(req, k, &RequestParam{Value: v, source: bodyParam})
 	}
 	return req, nil
 }
 
+// Check if a request has a json body, allowing params
+// such as a charset.
+func isJSON(r *http.Request) bool {
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && t == JSON
+}
+
+// Check if the params of a request method are sent in its body.
+func hasBody(method string) bool {
+	return method == "POST" || method == "PUT" || method == "PATCH"
+}
+
+// Get the registered filters.
+// Filters run without holding the lock, so they can register others.
+func registeredFilters() []Filter {
+	mu.RLock()
+	defer mu.RUnlock()
+	f := make([]Filter, 0, len(filters))
+	for _, v := range filters {
+		f = append(f, v)
+	}
+	return f
+}
+
 // Run all registered filters predispatch function.
 func preDispatch(r *http.Request, req Request) (err error) {
-	for _, v := range filters {
+	for _, v := range registeredFilters() {
 		err = v.PreDispatch(r, req)
 		if err != nil {
 			return err
@@ -147,9 +711,21 @@ func preDispatch(r *http.Request, req Request) (err error) {
 	return nil
 }
 
+// Run the filters observing the outcome of the controller.
+func postDispatchResult(r *http.Request, req Request, o Outcome) error {
+	for _, v := range registeredFilters() {
+		if f, ok := v.(PostDispatchResult); ok {
+			if err := f.PostDispatchResult(r, req, o); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Run all registered filters postdispatch function.
 func postDispatch(r *http.Request, req Request) (err error) {
-	for _, v := range filters {
+	for _, v := range registeredFilters() {
 		err = v.PostDispatch(r, req)
 		if err != nil {
 			return err
@@ -167,11 +743,36 @@ func upperFirst(s string) string {
 	return string(unicode.ToUpper(r)) + s[n:]
 }
 
+// function to get ensure first letter is lower case
+func lowerFirst(s string) string {
+	if s == "" {
+		return ""
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
+
+func (e FieldErrors) Error() string {
+	s := make([]string, len(e))
+	for i, v := range e {
+		s[i] = v.Field + ": " + v.Message
+	}
+	return strings.Join(s, ", ")
+}
+
+// Get every value sent for a param, in order.
+func (p *RequestParam) sent() []interface{} {
+	if p.values != nil {
+		return p.values
+	}
+	return []interface{}{p.Value}
+}
+
 // Get an interger param
 func (p *RequestParam) int() (int64, error) {
 	switch p.Value.(type) {
 	case string:
-		return strconv.ParseInt(p.Value.(string), 10, 64)
+		return parseInt(p.Value.(string))
 	case int64:
 		return p.Value.(int64), nil
 	case float64:
@@ -180,6 +781,16 @@ func (p *RequestParam) int() (int64, error) {
 	return -1, errors.New("Not Found")
 }
 
+// Parse an integer in base 10, or in the base of a 0x, 0o or 0b
+// prefix. A leading zero alone is still decimal, so 010 is 10.
+func parseInt(s string) (int64, error) {
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 1 && digits[0] == '0' && strings.ContainsRune("xXoObB", rune(digits[1])) {
+		return strconv.ParseInt(s, 0, 64)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
 // Get a float param
 func (p *RequestParam) float() (float64, error) {
 	switch p.Value.(type) {
@@ -204,165 +815,1188 @@ func (p *RequestParam) bool() (bool, error) {
 	return false, errors.New("Not Found")
 }
 
-// This is responsible for setting up the input parameter of a handler
-func setInputParam(i reflect.Value, req Request) (reflect.Value, error) {
-	p := i.Type().In(0)
-	t := reflect.New(p.Elem())
-	for k, v := range req {
-		k = upperFirst(k)
-		sv, f := p.Elem().FieldByName(k)
-		if !f {
-			return t, errors.New("Not Found")
+// Get a duration param, as in 30s.
+// An integer is a number of nanoseconds.
+func (p *RequestParam) duration() (time.Duration, error) {
+	switch p.Value.(type) {
+	case string:
+		if n, err := strconv.ParseInt(p.Value.(string), 10, 64); err == nil {
+			return time.Duration(n), nil
 		}
-		switch sv.Type.Kind() {
-		case reflect.Int64:
-			value, err := v.int()
-			if err != nil {
-				return t, err
-			}
-			t.Elem().FieldByName(k).SetInt(value)
-		case reflect.Float64:
-			value, err := v.float()
-			if err != nil {
-				return t, err
-			}
-			t.Elem().FieldByName(k).SetFloat(value)
-		case reflect.Bool:
-			value, err := v.bool()
-			if err != nil {
-				return t, err
-			}
-			t.Elem().FieldByName(k).SetBool(value)
-		case reflect.String:
-			t.Elem().FieldByName(k).SetString(v.Value.(string))
-		default:
-			return t, errors.New("Not Found")
+		return time.ParseDuration(p.Value.(string))
+	case int64:
+		return time.Duration(p.Value.(int64)), nil
+	case float64:
+		return time.Duration(p.Value.(float64)), nil
+	}
+	return 0, errors.New("Not Found")
+}
+
+// Get a string param, formatting the numbers and booleans
+// of a json body. Integers are written without an exponent.
+func (p *RequestParam) string() (string, error) {
+	switch p.Value.(type) {
+	case string:
+		return p.Value.(string), nil
+	case int64:
+		return strconv.FormatInt(p.Value.(int64), 10), nil
+	case float64:
+		return strconv.FormatFloat(p.Value.(float64), 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(p.Value.(bool)), nil
+	}
+	return "", errors.New("Not Found")
+}
+
+// Get the field with a `router` tag.
+// Tagged fields are never bound by name.
+func taggedField(t reflect.Type, tag string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Tag.Get("router") == tag {
+			return f, true
 		}
 	}
-	return t, nil
+	return reflect.StructField{}, false
 }
 
-// Register a filter
-//
-//  Usage:
-//
-//      go_router.RegisterFilte("filter", test_filter)
-//
-func RegisterFilter(name string, f Filter) error {
-	if _, ok := filters[name]; ok {
-		return errors.New("Filter name is already registered")
+// Get the field tagged with `body:"json"`, which the whole
+// json body is decoded into.
+func bodyField(t reflect.Type) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Tag.Get("body") == "json" {
+			return f, true
+		}
 	}
-	filters[name] = f
-	return nil
+	return reflect.StructField{}, false
 }
 
-// Register a route.
-// Parameters required are http method, url path and a controller.
-//
-//  Usage:
-//
-//      go_router.RegisterRoute(GET, "/v1/test/retrieve", test_controller.Retrieve)
-//      go_router.RegisterRoute(POST, "/v1/test/save", test_controller.Save)
-//
-func RegisterRoute(method string, path string, n Node) error {
-	if nodes, ok := routes[method]; ok {
-		if _, ok := nodes[path]; ok {
-			// log and return error
-			return errors.New("Route path has already been registered")
+// Check if a type is a map with string keys and the given values.
+func isStringMap(t reflect.Type, elem reflect.Kind) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == elem
+}
+
+// Fill the field tagged with `router:"present"` with the
+// body params sent by the client, as a []string or map[string]bool.
+func setPresent(t reflect.Value, f reflect.StructField, present []string) {
+	sort.Strings(present)
+	v := t.Elem().FieldByIndex(f.Index)
+	switch {
+	case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(present).Convert(f.Type))
+	case isStringMap(f.Type, reflect.Bool):
+		m := reflect.MakeMap(f.Type)
+		for _, k := range present {
+			m.SetMapIndex(reflect.ValueOf(k).Convert(f.Type.Key()), reflect.ValueOf(true))
 		}
+		v.Set(m)
 	}
-	if _, ok := routes[method]; !ok {
-		nodes := make(nodeMap)
-		nodes[path] = n
-		routes[method] = nodes
-		return nil
+}
+
+// Get the field bound from a param name.
+// A field tagged with `param:"user_id,userId,uid"` is bound from any
+// of the listed names rather than its own. Fields with a `router` tag
+// or a body tag are never bound by name.
+func paramField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag, ok := f.Tag.Lookup("param"); ok {
+			for _, alias := range strings.Split(tag, ",") {
+				if alias == name {
+					return f, true
+				}
+			}
+		}
 	}
-	nodes := routes[method]
-	nodes[path] = n
-	return nil
+	f, ok := t.FieldByName(upperFirst(name))
+	if !ok || f.Tag.Get("router") != "" || f.Tag.Get("body") != "" {
+		return f, false
+	}
+	if _, tagged := f.Tag.Lookup("param"); tagged {
+		return f, false
+	}
+	return f, true
 }
 
-// Dispatch a Request.
-// Only supports json responses.
-//
-//  Usage:
-//
-//      http.HandleFunc("/", router.Dispatch)
-//      http.ListenAndServe(":8080", nil)
-//
-func Dispatch(w http.ResponseWriter, r *http.Request) {
-	var routeKey string
-	// make a map for request params
-	req := make(Request)
-	w.Header().Set("Content-Type", JSON)
-	defer func() {
-		if err := recover(); err != nil {
-			// log the error using a logger.
-			// log.Error(err)
-			// print to terminal for now.
-			fmt.Println(err)
-			internalError(w, r)
+// Set a struct field from a param.
+// Errors with errUnsupportedKind for fields that can not be bound.
+func setField(f reflect.Value, v *RequestParam) error {
+	if reflect.PtrTo(f.Type()).Implements(textUnmarshalerType) {
+		s, ok := v.Value.(string)
+		if !ok {
+			return errors.New("Invalid value")
 		}
-	}()
-	err := r.ParseForm()
-	if err != nil {
-		// log the error and panic
-		panic(err)
+		return f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
 	}
-	switch r.Method {
-	case "GET", "DELETE":
-		routeKey, err = parseGet(r, req)
+	if f.Type() == durationType {
+		value, err := v.duration()
 		if err != nil {
-			notFound(w, r)
-			return
+			return errors.New("Invalid duration")
 		}
-	case "POST":
-		routeKey = r.URL.Path
-		req, err = parseBody(r, req)
+		f.SetInt(int64(value))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.Int64:
+		value, err := v.int()
 		if err != nil {
-			// log the error and panic
-			panic(err)
+			return errors.New("Invalid integer")
+		}
+		f.SetInt(value)
+	case reflect.Float64:
+		value, err := v.float()
+		if err != nil {
+			return errors.New("Invalid number")
+		}
+		f.SetFloat(value)
+	case reflect.Bool:
+		// a flag such as ?active is present without a value.
+		if v.source == queryParam && v.Value == "" {
+			f.SetBool(true)
+			return nil
+		}
+		value, err := v.bool()
+		if err != nil {
+			return errors.New("Invalid boolean")
+		}
+		f.SetBool(value)
+	case reflect.String:
+		value, err := v.string()
+		if err != nil {
+			return errors.New("Invalid string")
 		}
+		f.SetString(value)
 	default:
-		notSupported(w, r)
+		return errUnsupportedKind
+	}
+	return nil
+}
+
+// Check if a field is a slice of structs bound from a json list.
+func isStructSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct &&
+		!reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// Check if a field is a slice of single values, bound
+// from a repeated or separated param.
+func isParamSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Struct &&
+		!reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// Bind every value of a param into a slice, splitting strings such
+// as ?ids=1,2,3 on the separator of the field's `sep` tag, a comma
+// by default. A json list is bound element by element.
+// Errors name the element, as in ids[1]
+func bindSlice(f reflect.Value, sf reflect.StructField, name string, v *RequestParam) FieldErrors {
+	sep := ","
+	if tag := sf.Tag.Get("sep"); tag != "" {
+		sep = tag
+	}
+	var values []interface{}
+	for _, value := range v.sent() {
+		switch value := value.(type) {
+		case string:
+			if value == "" {
+				continue
+			}
+			for _, s := range strings.Split(value, sep) {
+				values = append(values, s)
+			}
+		case []interface{}:
+			values = append(values, value...)
+		default:
+			values = append(values, value)
+		}
+	}
+	var errs FieldErrors
+	s := reflect.MakeSlice(f.Type(), len(values), len(values))
+	for i, value := range values {
+		err := setField(s.Index(i), &RequestParam{Value: value, source: v.source})
+		if err == errUnsupportedKind {
+			return FieldErrors{{Field: name, Message: "Unsupported field"}}
+		}
+		if err != nil {
+			errs = append(errs, FieldError{Field: name + "[" + strconv.Itoa(i) + "]", Message: err.Error()})
+		}
+	}
+	f.Set(s)
+	return errs
+}
+
+// Check if a field is a struct bound from a json object
+// or from dotted params such as user.name
+func isStructField(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// Split a dotted param name such as user.name at its first dot.
+func splitDot(name string) (string, string, bool) {
+	i := strings.Index(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// Bind a json list of objects into a slice of structs.
+// Errors name the element and its field, as in items[1].name
+func bindStructs(f reflect.Value, name string, v *RequestParam) FieldErrors {
+	list, ok := v.Value.([]interface{})
+	if !ok {
+		return FieldErrors{{Field: name, Message: "Invalid list"}}
+	}
+	var errs FieldErrors
+	s := reflect.MakeSlice(f.Type(), len(list), len(list))
+	for i, e := range list {
+		prefix := name + "[" + strconv.Itoa(i) + "]"
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			errs = append(errs, FieldError{Field: prefix, Message: "Invalid object"})
+			continue
+		}
+		errs = append(errs, bindStruct(s.Index(i), prefix, m, v.source)...)
+	}
+	f.Set(s)
+	return errs
+}
+
+// Bind a json object into a struct. Dotted keys such as
+// address.city are bound into the nested struct, and can not
+// be sent along with an object for the same field.
+// Errors name the field, as in user.address.city
+func bindStruct(item reflect.Value, prefix string, m map[string]interface{}, source paramSource) FieldErrors {
+	var errs FieldErrors
+	for k, value := range m {
+		field := prefix + "." + k
+		if base, rest, ok := splitDot(k); ok {
+			if sf, found := paramField(item.Type(), base); found && isStructField(sf.Type) {
+				if _, sent := m[base]; sent {
+					errs = append(errs, FieldError{Field: field, Message: "Conflicts with " + prefix + "." + base})
+					continue
+				}
+				nested := map[string]interface{}{rest: value}
+				errs = append(errs, bindStruct(item.FieldByIndex(sf.Index), prefix+"."+base, nested, source)...)
+				continue
+			}
+		}
+		sf, found := paramField(item.Type(), k)
+		if !found {
+			errs = append(errs, FieldError{Field: field, Message: "Unknown field"})
+			continue
+		}
+		p := &RequestParam{Value: value, source: source}
+		fv := item.FieldByIndex(sf.Index)
+		if isStructSlice(sf.Type) {
+			errs = append(errs, bindStructs(fv, field, p)...)
+			continue
+		}
+		if isParamSlice(sf.Type) {
+			errs = append(errs, bindSlice(fv, sf, field, p)...)
+			continue
+		}
+		if isStructField(sf.Type) {
+			errs = append(errs, bindObject(fv, field, p)...)
+			continue
+		}
+		err := setField(fv, p)
+		if err == errUnsupportedKind {
+			err = errors.New("Unsupported field")
+		}
+		if err != nil {
+			errs = append(errs, FieldError{Field: field, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// Bind a json object param into a struct field.
+func bindObject(f reflect.Value, name string, v *RequestParam) FieldErrors {
+	m, ok := v.Value.(map[string]interface{})
+	if !ok {
+		return FieldErrors{{Field: name, Message: "Invalid object"}}
+	}
+	return bindStruct(f, name, m, v.source)
+}
+
+// Split a param in bracket notation, as in filter[status]
+func splitBracket(name string) (string, string, bool) {
+	i := strings.Index(name, "[")
+	if i <= 0 || !strings.HasSuffix(name, "]") {
+		return "", "", false
+	}
+	return name[:i], name[i+1 : len(name)-1], true
+}
+
+// Set a key of a string map field, making the map if needed.
+func setMapIndex(m reflect.Value, key string, value string) {
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	m.SetMapIndex(reflect.ValueOf(key).Convert(m.Type().Key()),
+		reflect.ValueOf(value).Convert(m.Type().Elem()))
+}
+
+// This is responsible for setting up the input parameter of a handler
+// Fields of a type with a registered param decoder are bound by it.
+// The field tagged with `body:"json"` gets the whole json body decoded
+// into it, and body params without a field of their own are left to it.
+// Fields implementing encoding.TextUnmarshaler are bound from strings,
+// slices of structs from json lists of objects.
+// Every param that fails to convert is reported in the FieldErrors,
+// as are aliases of one field sent with different values.
+// Params in bracket notation, as in filter[status]=active, are bound
+// into a string map field keyed by the bracket contents.
+// Query params without a matching field are collected by the field
+// tagged with `router:"query"` if there is one, and ignored otherwise.
+func setInputParam(i reflect.Value, req Request, body []byte) (reflect.Value, error) {
+	p := i.Type().In(i.Type().NumIn() - 1)
+	t := reflect.New(p.Elem())
+	bf, hasJSONBody := bodyField(p.Elem())
+	qf, hasQuery := taggedField(p.Elem(), "query")
+	hasQuery = hasQuery && isStringMap(qf.Type, reflect.String)
+	pf, hasPresent := taggedField(p.Elem(), "present")
+	var present []string
+	var errs FieldErrors
+	// the param each field was bound from.
+	bound := make(map[string]string)
+	for name, v := range req {
+		if v.source == bodyParam {
+			present = append(present, name)
+		}
+		if df, ok := paramField(p.Elem(), name); ok {
+			if fn, ok := getParamDecoder(df.Type); ok {
+				bound[df.Name] = name
+				if err := decodeParam(t.Elem().FieldByIndex(df.Index), fn, v); err != nil {
+					errs = append(errs, FieldError{Field: name, Message: err.Error()})
+				}
+				continue
+			}
+		}
+		if sf, ok := paramField(p.Elem(), name); ok && isParamSlice(sf.Type) {
+			bound[sf.Name] = name
+			errs = append(errs, bindSlice(t.Elem().FieldByIndex(sf.Index), sf, name, v)...)
+			continue
+		}
+		if v.conflict {
+			errs = append(errs, FieldError{Field: name, Message: "Sent with conflicting values"})
+			continue
+		}
+		if base, key, ok := splitBracket(name); ok {
+			if mf, found := paramField(p.Elem(), base); found && isStringMap(mf.Type, reflect.String) {
+				value, isString := v.Value.(string)
+				switch {
+				case strings.ContainsAny(key, "[]"):
+					errs = append(errs, FieldError{Field: name, Message: "Nested brackets are not supported"})
+				case !isString:
+					errs = append(errs, FieldError{Field: name, Message: "Invalid string"})
+				default:
+					setMapIndex(t.Elem().FieldByIndex(mf.Index), key, value)
+				}
+				continue
+			}
+		}
+		if base, rest, ok := splitDot(name); ok {
+			if sf, found := paramField(p.Elem(), base); found && isStructField(sf.Type) {
+				if _, sent := req[base]; sent {
+					errs = append(errs, FieldError{Field: name, Message: "Conflicts with " + base})
+					continue
+				}
+				nested := map[string]interface{}{rest: v.Value}
+				errs = append(errs, bindStruct(t.Elem().FieldByIndex(sf.Index), base, nested, v.source)...)
+				continue
+			}
+		}
+		sv, f := paramField(p.Elem(), name)
+		if !f && v.source == queryParam {
+			if hasQuery {
+				setMapIndex(t.Elem().FieldByIndex(qf.Index), name, v.Value.(string))
+			}
+			continue
+		}
+		if !f && v.source == bodyParam && hasJSONBody {
+			// decoded with the rest of the body.
+			continue
+		}
+		if !f {
+			return t, errors.New("Not Found")
+		}
+		if other, ok := bound[sv.Name]; ok {
+			if fmt.Sprint(req[other].Value) != fmt.Sprint(v.Value) {
+				errs = append(errs, FieldError{Field: name, Message: "Conflicts with " + other})
+			}
+			continue
+		}
+		bound[sv.Name] = name
+		fv := t.Elem().FieldByIndex(sv.Index)
+		if isStructSlice(sv.Type) {
+			errs = append(errs, bindStructs(fv, name, v)...)
+			continue
+		}
+		if isStructField(sv.Type) {
+			errs = append(errs, bindObject(fv, name, v)...)
+			continue
+		}
+		err := setField(fv, v)
+		if err == errUnsupportedKind {
+			return t, errors.New("Not Found")
+		}
+		if err != nil {
+			errs = append(errs, FieldError{Field: name, Message: err.Error()})
+		}
+	}
+	if hasPresent {
+		setPresent(t, pf, present)
+	}
+	if hasJSONBody && len(body) > 0 {
+		if err := json.Unmarshal(body, t.Elem().FieldByIndex(bf.Index).Addr().Interface()); err != nil {
+			errs = append(errs, FieldError{Field: paramName(bf), Message: "Invalid json"})
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(a, b int) bool { return errs[a].Field < errs[b].Field })
+		return t, errs
+	}
+	return t, nil
+}
+
+// Bind request params to the input struct of a controller as Dispatch
+// does, returning a pointer to the struct, so binding can be tested
+// without a request. The error is FieldErrors for params that could
+// not be bound.
+//
+//  Usage:
+//
+//      v, err := go_router.Bind(user_controller.Get, go_router.Request{
+//          "id": &go_router.RequestParam{Value: "42"},
+//      })
+//
+func Bind(n Node, req Request) (interface{}, error) {
+	if _, err := inputType(n); err != nil {
+		return nil, err
+	}
+	t, err := setInputParam(reflect.ValueOf(n), req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.Interface(), nil
+}
+
+// Maps of request params reused across requests.
+var requestPool = sync.Pool{New: func() interface{} { return make(Request) }}
+
+// Number of params above which a map is not reused,
+// so one large request does not keep its memory.
+const maxPooledParams = 64
+
+// Get an empty map for the params of a request.
+func getRequest() Request {
+	return requestPool.Get().(Request)
+}
+
+// Clear the params of a finished request and reuse the map.
+// Filters must not keep the request params past PostDispatch.
+func putRequest(req Request) {
+	if len(req) > maxPooledParams {
 		return
 	}
-	// get controller node from routes map.
-	c, err := getNode(r.Method, routeKey)
+	for k := range req {
+		delete(req, k)
+	}
+	requestPool.Put(req)
+}
+
+// Get the semaphore limiting concurrent requests to MaxConcurrent.
+// Returns nil when there is no limit.
+func semaphore() chan struct{} {
+	semMu.Lock()
+	defer semMu.Unlock()
+	if MaxConcurrent <= 0 {
+		return nil
+	}
+	if cap(sem) != MaxConcurrent {
+		sem = make(chan struct{}, MaxConcurrent)
+	}
+	return sem
+}
+
+// Get the deadline of a request.
+// In debug mode the X-Request-Deadline header can shorten it,
+// so timeouts can be exercised on demand.
+func requestTimeout(r *http.Request, rt *route) time.Duration {
+	d := RequestTimeout
+	if rt.timeout > 0 {
+		d = rt.timeout
+	}
+	if DebugMode {
+		v, err := time.ParseDuration(r.Header.Get(DeadlineHeader))
+		if err == nil && v > 0 && (d == 0 || v < d) {
+			d = v
+		}
+	}
+	return d
+}
+
+// Call a controller, giving up once the context is done.
+// The controller keeps running in its goroutine after a timeout,
+// which is why it should watch its context.
+func callTimeout(ctx context.Context, i reflect.Value, args []reflect.Value) ([]reflect.Value, error) {
+	done := make(chan []reflect.Value, 1)
+	panics := make(chan controllerPanic, 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				panics <- controllerPanic{value: err, stack: debug.Stack()}
+			}
+		}()
+		done <- i.Call(args)
+	}()
+	select {
+	case cont := <-done:
+		return cont, nil
+	case p := <-panics:
+		panic(p)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Register a filter
+//
+//  Usage:
+//
+//      go_router.RegisterFilte("filter", test_filter)
+//
+func RegisterFilter(name string, f Filter) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := filters[name]; ok {
+		return errors.New("Filter name is already registered")
+	}
+	filters[name] = f
+	return nil
+}
+
+// Register a filter, replacing any filter registered under the name,
+// as tests and reloaded configuration need.
+//
+//  Usage:
+//
+//      go_router.ReplaceFilter("filter", test_filter)
+//
+func ReplaceFilter(name string, f Filter) {
+	mu.Lock()
+	defer mu.Unlock()
+	filters[name] = f
+}
+
+// Register a route.
+// Parameters required are http method, url path and a controller,
+// followed by any route options.
+//
+// The path can be a pattern with named params such as /v1/users/{id},
+// or a trailing catch-all such as /v1/files/{path...}.
+// When several routes match a request, literal segments beat params
+// and params beat catch-alls, comparing segments from left to right.
+// Registering a pattern that matches exactly the same paths as an
+// existing pattern for the method is an error.
+// A route registered for ANY handles every method its path
+// has no route for. Methods other than GET, HEAD, POST, PUT, PATCH
+// and DELETE, such as OPTIONS, are only dispatched to ANY routes.
+//
+//  Usage:
+//
+//      go_router.RegisterRoute(GET, "/v1/test/retrieve", test_controller.Retrieve)
+//      go_router.RegisterRoute(POST, "/v1/test/save", test_controller.Save)
+//      go_router.RegisterRoute(GET, "/v1/users/{id}", user_controller.Get)
+//      go_router.RegisterRoute(go_router.ANY, "/v1/proxy/forward", proxy_controller.Forward)
+//      go_router.RegisterRoute(GET, "/v1/country/list", country_controller.List,
+//          go_router.WithTimeout(time.Second), go_router.WithCache(time.Hour))
+//
+func RegisterRoute(method string, path string, n Node, opts ...RouteOption) error {
+	rt := &route{node: n}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return addRoute(method, path, rt)
+}
+
+// Give a route its own timeout.
+// It overrides RequestTimeout for the route, a zero timeout
+// keeps the default.
+func WithTimeout(d time.Duration) RouteOption {
+	return func(rt *route) {
+		rt.timeout = d
+	}
+}
+
+// Let the successful responses of a route be cached.
+// Sets Cache-Control: max-age on them, a zero max age sets no header.
+func WithCache(maxAge time.Duration) RouteOption {
+	return func(rt *route) {
+		rt.cacheMaxAge = maxAge
+	}
+}
+
+// Accept only request bodies of the given content types on a route,
+// rejecting others with a 415. It overrides RequireJSONContentType
+// for the route. Bodies other than json are not bound to params.
+//
+//  Usage:
+//
+//      go_router.RegisterRoute(POST, "/v1/files/upload", file_controller.Upload,
+//          go_router.WithAccepts("multipart/form-data"))
+//
+func WithAccepts(contentTypes ...string) RouteOption {
+	return func(rt *route) {
+		rt.contentTypes = contentTypes
+	}
+}
+
+// Check if a route accepts the content type of a request body.
+func (rt *route) acceptsBody(r *http.Request) bool {
+	if len(rt.contentTypes) == 0 {
+		return !RequireJSONContentType || isJSON(r)
+	}
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 	if err != nil {
-		notFound(w, r)
+		return false
+	}
+	for _, v := range rt.contentTypes {
+		if strings.EqualFold(v, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Respond to not found, unauthorized and forbidden requests on a route
+// with the status alone, so they tell a scanner nothing else. It applies
+// to an HTTPError with one of those statuses too.
+//
+//  Usage:
+//
+//      go_router.RegisterRoute(GET, "/v1/admin/{id}", admin_controller.Get, go_router.WithBareErrors())
+//
+func WithBareErrors() RouteOption {
+	return func(rt *route) {
+		rt.bareErrors = true
+	}
+}
+
+// Write only the status of an error on a route with bare errors.
+// Returns true when the response is written.
+func bareError(w http.ResponseWriter, r *http.Request, status int) bool {
+	rt := getRoute(r)
+	if rt == nil || !rt.bareErrors {
+		return false
+	}
+	switch status {
+	case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+		w.WriteHeader(status)
+		return true
+	}
+	return false
+}
+
+// Write the responses of a route as they are produced,
+// rather than buffering them until they are complete.
+func WithoutBuffering() RouteOption {
+	return func(rt *route) {
+		rt.unbuffered = true
+	}
+}
+
+// Add a route to the routes map,
+// or to the route patterns when the path has params.
+func addRoute(method string, path string, rt *route) error {
+	mu.Lock()
+	defer mu.Unlock()
+	rt.method, rt.path = method, path
+	if t, err := inputType(rt.node); err == nil {
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Tag.Get("path") == "remainder" {
+				rt.remainder = lowerFirst(t.Field(i).Name)
+			}
+		}
+	}
+	if existing := registeredRoute(method, path); existing != nil {
+		if ok, err := addVersion(existing, rt); ok {
+			return err
+		}
+	}
+	if isPattern(path) {
+		return registerPattern(method, path, rt)
+	}
+	if nodes, ok := routes[method]; ok {
+		if _, ok := nodes[path]; ok {
+			// log and return error
+			return errors.New("Route path has already been registered")
+		}
+	}
+	folded := strings.ToLower(path)
+	if existing, ok := foldedRoutes[method][folded]; ok && CaseInsensitivePaths {
+		return errors.New("Route path differs only by case from " + existing.path)
+	}
+	if _, ok := foldedRoutes[method]; !ok {
+		foldedRoutes[method] = make(nodeMap)
+	}
+	if _, ok := foldedRoutes[method][folded]; !ok {
+		foldedRoutes[method][folded] = rt
+	}
+	if _, ok := routes[method]; !ok {
+		nodes := make(nodeMap)
+		nodes[path] = rt
+		routes[method] = nodes
+		return nil
+	}
+	nodes := routes[method]
+	nodes[path] = rt
+	return nil
+}
+
+// Rewrite the url path a request is matched to a route by, as to
+// route /me/profile to the profile of the signed in user.
+// The rewriter sees the request once its path is canonical and before
+// any filter runs, the path it returns is made canonical in turn and
+// an empty one keeps the request path. Only matching uses the
+// rewritten path, r.URL is left as sent.
+//
+//  Usage:
+//
+//      go_router.SetRouteRewriter(func(r *http.Request) string {
+//          return strings.Replace(r.URL.Path, "/me/", "/users/"+session.UserID(r)+"/", 1)
+//      })
+//
+func SetRouteRewriter(fn func(r *http.Request) string) {
+	mu.Lock()
+	defer mu.Unlock()
+	routeRewriter = fn
+}
+
+// Get the route rewriter, nil when there is none.
+func getRouteRewriter() func(r *http.Request) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return routeRewriter
+}
+
+// Transform the value of every successful response before it is
+// marshaled by the encoder of the request, as to wrap it in an envelope.
+// Errors and streams are written as they are.
+//
+//  Usage:
+//
+//      go_router.SetResponseTransformer(func(r *http.Request, v interface{}) interface{} {
+//          return map[string]interface{}{"ok": true, "data": v}
+//      })
+//
+func SetResponseTransformer(fn func(r *http.Request, v interface{}) interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	responseTransformer = fn
+}
+
+// Get the response transformer, nil when there is none.
+func getResponseTransformer() func(r *http.Request, v interface{}) interface{} {
+	mu.RLock()
+	defer mu.RUnlock()
+	return responseTransformer
+}
+
+// Get the route registered for a method and path, which is
+// matched to the pattern of the same path.
+func registeredRoute(method string, path string) *route {
+	if rt, ok := routes[method][path]; ok {
+		return rt
+	}
+	for _, p := range patterns[method] {
+		if p.path == path {
+			return p.route
+		}
+	}
+	return nil
+}
+
+// Set the handler for requests under a path prefix that match no route.
+// The longest matching prefix wins, requests matching no prefix
+// get the default not found response.
+//
+//  Usage:
+//
+//      go_router.SetNotFoundForPrefix("/v1", v1_controller.NotFound)
+//
+func SetNotFoundForPrefix(prefix string, h http.HandlerFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	notFoundHandlers[strings.TrimRight(prefix, "/")] = h
+}
+
+// Get a handler dispatching requests mounted under a prefix
+// of an http.ServeMux, so routes are registered without it.
+//
+//  Usage:
+//
+//      mux := http.NewServeMux()
+//      mux.Handle("/api/", go_router.StripPrefix("/api/"))
+//      go_router.RegisterRoute(GET, "/v1/test/retrieve", test_controller.Retrieve)
+//
+func StripPrefix(prefix string) http.Handler {
+	return http.StripPrefix(strings.TrimRight(prefix, "/"), http.HandlerFunc(Dispatch))
+}
+
+// Remove every registered route, filter, not found handler,
+// translation, param decoder and response callback, every encoder but
+// json and xml and every compressor but gzip. Also clears the https
+// policy, the trusted proxies, the response transformer and the route
+// rewriter. Lets tests start from a clean slate.
+//
+//  Usage:
+//
+//      go_router.Reset()
+//
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	routes = make(routeMap)
+	foldedRoutes = make(routeMap)
+	patterns = make(patternMap)
+	patternTrees = make(map[string]*patternNode)
+	filters = make(filterMap)
+	notFoundHandlers = make(map[string]http.HandlerFunc)
+	encoders = defaultEncoders()
+	messages = defaultMessages()
+	compressors = defaultCompressors()
+	decoders = make(map[reflect.Type]ParamDecoder)
+	httpsOnly, hstsMaxAge = false, 0
+	trustedProxies = nil
+	responseTransformer = nil
+	routeRewriter = nil
+	responseCallbacks = nil
+}
+
+// Run the post dispatch filters once the response is written.
+// PostDispatch only runs for a controller that succeeded, while filters
+// implementing PostDispatchResult see every outcome.
+// A buffered response is replaced by an HTTPError from a filter.
+// Returns false when the request is done.
+func afterDispatch(w *responseBuffer, r *http.Request, req Request, o Outcome) bool {
+	o.Status = w.status
+	if o.Status == 0 {
+		o.Status = http.StatusOK
+	}
+	var err error
+	if o.Err == nil {
+		err = postDispatch(r, req)
+	}
+	if err == nil {
+		err = postDispatchResult(r, req, o)
+	}
+	if e, ok := asHTTPError(err); ok && !w.direct {
+		w.reset()
+		writeHTTPError(w, r, e)
+		return false
+	}
+	if err != nil {
+		// log the error and panic
+		panic(err)
+	}
+	return o.Err == nil
+}
+
+// Dispatch a Request.
+// Responds with json, unless the final path segment has the extension
+// of a registered encoder, as in /v1/report.xml
+// A controller returning a channel has its elements streamed
+// as a json array.
+// Other responses are buffered until the post dispatch filters ran,
+// so an error from one still replaces the response, unless the route
+// is registered WithoutBuffering.
+//
+//  Usage:
+//
+//      http.HandleFunc("/", router.Dispatch)
+//      http.ListenAndServe(":8080", nil)
+//
+func Dispatch(w http.ResponseWriter, r *http.Request) {
+	// get a map for request params, reused once the request is done.
+	req := getRequest()
+	defer putRequest(req)
+	r = withValues(r)
+	start := time.Now()
+	if s := semaphore(); s != nil {
+		select {
+		case s <- struct{}{}:
+			defer func() { <-s }()
+		default:
+			overloaded(w, r)
+			finishRequest(r, nil, http.StatusServiceUnavailable, start)
+			return
+		}
+	}
+	var rt *route
+	buf := newResponseBuffer(w)
+	buf.encoding, buf.compressor, _ = negotiateCompressor(r)
+	buf.head = r.Method == "HEAD"
+	defer func() {
+		if err := buf.flush(); err != nil {
+			logWriteError(r, rt, err)
+		}
+		finishRequest(r, rt, buf.status, start)
+	}()
+	w = buf
+	defer func() {
+		if err := recover(); err != nil {
+			stack := debug.Stack()
+			if p, ok := err.(controllerPanic); ok {
+				err, stack = p.value, p.stack
+			}
+			logPanic(r, err, stack)
+			if buf.committed {
+				// the client already has part of the response.
+				Logger.Printf("%s %s: response already started, the error is not written", r.Method, r.URL.Path)
+				return
+			}
+			buf.reset()
+			renderPanic(buf, r, err)
+		}
+	}()
+	if enforceHTTPS(w, r) {
+		return
+	}
+	if MaxBodySize > 0 && r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
+	}
+	err := r.ParseForm()
+	if isTooLarge(err) {
+		tooLarge(w, r)
 		return
 	}
-	i := reflect.ValueOf(c)
-	t, err := setInputParam(i, req)
 	if err != nil {
-		notFound(w, r)
+		// log the error and panic
+		panic(err)
+	}
+	// other methods only reach ANY routes.
+	supported := true
+	switch r.Method {
+	case "GET", "HEAD", "DELETE", "POST", "PUT", "PATCH":
+	default:
+		supported = false
+	}
+	if p, err := cleanPath(r.URL.Path); err != nil {
+		badRequest(w, r)
 		return
+	} else if p != r.URL.Path {
+		u := *r.URL
+		u.Path, u.RawPath = p, ""
+		r = r.WithContext(r.Context())
+		r.URL = &u
+	}
+	key := r.URL.Path
+	if fn := getRouteRewriter(); fn != nil {
+		if p := fn(r); p != "" {
+			if key, err = cleanPath(p); err != nil {
+				badRequest(w, r)
+				return
+			}
+		}
+	}
+	// get controller node from routes map.
+	// the extension of the final segment selects the encoding.
+	rt, req, enc, err := matchEncoding(r.Method, key, req)
+	if !supported && (err != nil || rt.method != ANY) {
+		notSupported(w, r)
+		return
+	}
+	if err == errNotAcceptable {
+		notAcceptable(w, r)
+		return
+	}
+	if err != nil {
+		noRoute(w, r, err)
+		return
+	}
+	if rt.versions != nil || rt.version != "" {
+		w.Header().Add("Vary", "Accept")
+		if rt = rt.variant(r); rt == nil {
+			notAcceptable(w, r)
+			return
+		}
+	}
+	setRoute(r, rt)
+	if hasBody(r.Method) {
+		if !rt.acceptsBody(r) {
+			unsupportedMediaType(w, r)
+			return
+		}
+		// bodies of the other accepted types are left to the controller.
+		if len(rt.contentTypes) == 0 || isJSON(r) {
+			req, err = parseBody(r, req)
+		}
+		if isTooLarge(err) {
+			tooLarge(w, r)
+			return
+		}
+		if err != nil {
+			// log the error and panic
+			panic(err)
+		}
 	}
 	req = parseForm(r, req)
+	// streams outlive the deadline, which only bounds the controller.
+	stream := r
+	d := requestTimeout(r, rt)
+	if d > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	// filters run before binding, so a rejected request
+	// is never told which of its params are bad.
 	err = preDispatch(r, req)
+	if errors.Is(err, ErrUnauthorized) {
+		unauthorized(w, r)
+		return
+	}
+	if e, ok := asHTTPError(err); ok {
+		writeHTTPError(w, r, e)
+		return
+	}
 	if err != nil {
 		// log the error and panic
 		panic(err)
 	}
+	i := reflect.ValueOf(rt.node)
+	var body []byte
+	if v := getValues(r); v != nil {
+		body = v.body
+	}
+	t, err := setInputParam(i, req, body)
+	if errs, ok := err.(FieldErrors); ok {
+		badParams(w, r, errs)
+		return
+	}
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+	if !validInput(w, r, t) {
+		return
+	}
 	// invoke the controller.
-	cont := i.Call([]reflect.Value{t})
+	args := []reflect.Value{t}
+	switch i.Type().NumIn() {
+	case 2:
+		args = []reflect.Value{reflect.ValueOf(controllerContext(r)), t}
+	case 3:
+		args = []reflect.Value{reflect.ValueOf(w), reflect.ValueOf(r), t}
+	}
+	var cont []reflect.Value
+	// a controller writing the response is never left running
+	// on its own, the deadline is still on its request.
+	if d > 0 && i.Type().NumIn() != 3 {
+		cont, err = callTimeout(r.Context(), i, args)
+		if err != nil {
+			timeout(w, r)
+			afterDispatch(buf, r, req, Outcome{Err: err})
+			return
+		}
+	} else {
+		cont = i.Call(args)
+	}
 	if !cont[1].IsNil() {
 		err = cont[1].Interface().(error)
-		if err != nil {
+		if err == Handled {
+			afterDispatch(buf, r, req, Outcome{})
+			return
+		}
+		e, isHTTPError := asHTTPError(err)
+		switch {
+		case errors.Is(err, ErrNotFound) && r.Method == "DELETE" && DeleteMissingIsOK:
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, ErrNotFound):
+			notFound(w, r)
+		case isHTTPError:
+			writeHTTPError(w, r, e)
+		default:
+			// the controller error wins over any from the filters.
+			postDispatchResult(r, req, Outcome{Status: http.StatusInternalServerError, Err: err})
 			// log the error and panic
 			panic(err)
 		}
+		afterDispatch(buf, r, req, Outcome{Err: err})
+		return
 	}
-	err = postDispatch(r, req)
-	if err != nil {
-		// log the error and panic
-		panic(err)
+	res := cont[0].Interface()
+	ch := reflect.ValueOf(res)
+	s, isSSE := res.(SSEStream)
+	rc, isReader := res.(io.ReadCloser)
+	if isReader {
+		// closed even when the response fails.
+		defer func() {
+			if err := rc.Close(); err != nil {
+				Logger.Printf("%s %s: can not close the stream: %v", r.Method, r.URL.Path, err)
+			}
+		}()
+	}
+	if isSSE || isReader || isStream(ch) {
+		if !afterDispatch(buf, r, req, Outcome{Value: res}) {
+			return
+		}
+		// streams are written as they are produced.
+		if err := buf.stream(); err != nil {
+			logWriteError(r, rt, err)
+			return
+		}
+		switch {
+		case isSSE:
+			streamEvents(w, stream, s)
+		case isReader:
+			streamReader(w, stream, rc)
+		default:
+			streamArray(w, stream, ch)
+		}
+		writeTrailers(w, res)
+		return
 	}
-	data, err := json.Marshal(cont[0].Interface())
+	if rt.unbuffered {
+		if err := buf.stream(); err != nil {
+			logWriteError(r, rt, err)
+			return
+		}
+	}
+	status := http.StatusOK
+	switch v := res.(type) {
+	case Page:
+		res = v.withParams(req)
+	case *Page:
+		res = v.withParams(req)
+	case MultiStatus:
+		res, status = v.withResults(), http.StatusMultiStatus
+	case *MultiStatus:
+		if v != nil {
+			res, status = v.withResults(), http.StatusMultiStatus
+		}
+	}
+	value := res
+	if fn := getResponseTransformer(); fn != nil {
+		value = fn(r, res)
+	}
+	data, err := enc.Marshal(value)
 	if err != nil {
-		// log the error and panic
-		panic(err)
+		marshalError(w, r, rt, err)
+	} else {
+		w.Header().Set("Content-Type", enc.ContentType)
+		if rt.cacheMaxAge > 0 {
+			w.Header().Set("Cache-Control", "max-age="+strconv.FormatInt(int64(rt.cacheMaxAge/time.Second), 10))
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+		}
+		if _, err := fmt.Fprintf(w, "%s", string(data)); err != nil {
+			logWriteError(r, rt, err)
+			return
+		}
 	}
-	fmt.Fprintf(w, "%s", string(data))
+	afterDispatch(buf, r, req, Outcome{Value: res})
 }
@@ -0,0 +1,987 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testInput struct {
+	Id   string
+	Name string
+}
+
+func testController(t *testInput) (string, error) {
+	return t.Id, nil
+}
+
+// Dispatch a request, returning the response.
+func serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	Dispatch(w, r)
+	return w
+}
+
+// Dispatch a request with an optional body.
+func do(method string, path string, body string) *httptest.ResponseRecorder {
+	return serve(httptest.NewRequest(method, path, strings.NewReader(body)))
+}
+
+// Capture what is logged until the returned function is called.
+func captureLog() (*bytes.Buffer, func()) {
+	var buf bytes.Buffer
+	Logger = log.New(&buf, "", 0)
+	return &buf, func() { Logger = log.New(os.Stderr, "", log.LstdFlags) }
+}
+
+func TestMarshalError(t *testing.T) {
+	Reset()
+	logged, restore := captureLog()
+	defer restore()
+	RegisterRoute("GET", "/v1/test/func", func(t *testInput) (interface{}, error) {
+		return func() {}, nil
+	})
+	w := do("GET", "/v1/test/func", "")
+	if w.Code != 500 || w.Header().Get("Content-Type") != JSON {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Body.String() != `{"error":"Internal Server Error"}` {
+		t.Fatalf("got body %s", w.Body)
+	}
+	if !strings.Contains(logged.String(), "GET /v1/test/func") {
+		t.Fatalf("got log %q", logged)
+	}
+	DebugMode = true
+	defer func() { DebugMode = false }()
+	if w := do("GET", "/v1/test/func", ""); !strings.Contains(w.Body.String(), `"detail":"json: unsupported type`) {
+		t.Fatalf("got body %s", w.Body)
+	}
+}
+
+func panickingController(t *testInput) (string, error) {
+	panic("boom")
+}
+
+func TestPanicStack(t *testing.T) {
+	Reset()
+	logged, restore := captureLog()
+	defer restore()
+	RegisterRoute("GET", "/v1/test/panic", panickingController)
+	if w := do("GET", "/v1/test/panic", ""); w.Code != 500 {
+		t.Fatalf("got %d", w.Code)
+	}
+	if !strings.Contains(logged.String(), "boom") || !strings.Contains(logged.String(), "panickingController") {
+		t.Fatalf("got log %q", logged)
+	}
+	if strings.Contains(logged.String(), "runtime/debug.Stack") {
+		t.Fatalf("got the full stack outside debug mode %q", logged)
+	}
+	logged.Reset()
+	DebugMode = true
+	defer func() { DebugMode = false }()
+	do("GET", "/v1/test/panic", "")
+	if !strings.Contains(logged.String(), "runtime/debug.Stack") {
+		t.Fatalf("got a trimmed stack in debug mode %q", logged)
+	}
+}
+
+type queryInput struct {
+	Limit int64
+	Query map[string]string `router:"query"`
+}
+
+func TestQueryMap(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/search", func(t *queryInput) (*queryInput, error) { return t, nil })
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	w := do("GET", "/v1/test/search?limit=1&color=red&size=m", "")
+	if w.Code != 200 || w.Body.String() != `{"Limit":1,"Query":{"color":"red","size":"m"}}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/v1/test/retrieve?color=red", ""); w.Code != 200 {
+		t.Fatalf("unknown query params should be ignored without a query map, got %d", w.Code)
+	}
+}
+
+// Waits for the context to end or for 50ms to pass.
+func slowController(ctx context.Context, t *testInput) (string, error) {
+	select {
+	case <-time.After(50 * time.Millisecond):
+	case <-ctx.Done():
+	}
+	return "done", nil
+}
+
+func TestRouteTimeout(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/short", slowController, WithTimeout(10*time.Millisecond))
+	RegisterRoute("GET", "/v1/test/long", slowController, WithTimeout(time.Second))
+	RequestTimeout = 20 * time.Millisecond
+	defer func() { RequestTimeout = 0 }()
+	if w := do("GET", "/v1/test/short", ""); w.Code != 503 {
+		t.Fatalf("got %d, want 503", w.Code)
+	}
+	if w := do("GET", "/v1/test/long", ""); w.Code != 200 || w.Body.String() != `"done"` {
+		t.Fatalf("got %d %s, the route timeout should override RequestTimeout", w.Code, w.Body)
+	}
+}
+
+type typedInput struct {
+	Count  int64
+	Active bool
+	Price  float64
+}
+
+func TestFieldErrors(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/test/save", func(t *typedInput) (*typedInput, error) { return t, nil })
+	w := do("POST", "/v1/test/save", `{"count":"x","active":"y","price":1.5}`)
+	if w.Code != 400 || w.Header().Get("Content-Type") != JSON {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := `[{"field":"active","message":"Invalid boolean"},{"field":"count","message":"Invalid integer"}]`
+	if w.Body.String() != want {
+		t.Fatalf("got %s, want %s", w.Body, want)
+	}
+}
+
+type patchInput struct {
+	Id      int64
+	Name    string
+	Email   string
+	Present []string `router:"present"`
+}
+
+type patchMapInput struct {
+	Id      int64
+	Name    string
+	Present map[string]bool `router:"present"`
+}
+
+func TestPatchPresence(t *testing.T) {
+	Reset()
+	var got *patchInput
+	RegisterRoute("PATCH", "/v1/users/{id}", func(t *patchInput) (string, error) {
+		got = t
+		return "", nil
+	})
+	w := do("PATCH", "/v1/users/4", `{"name":"bob","email":""}`)
+	if w.Code != 200 {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if got.Id != 4 || got.Name != "bob" || strings.Join(got.Present, ",") != "email,name" {
+		t.Fatalf("got %+v", got)
+	}
+	var sent map[string]bool
+	RegisterRoute("PATCH", "/v1/accounts/{id}", func(t *patchMapInput) (string, error) {
+		sent = t.Present
+		return "", nil
+	})
+	do("PATCH", "/v1/accounts/4", `{"name":"bob"}`)
+	if len(sent) != 1 || !sent["name"] {
+		t.Fatalf("got %v, path params are not present in the body", sent)
+	}
+}
+
+func TestReset(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	RegisterFilter("user", userFilter{new(interface{})})
+	Reset()
+	if w := do("GET", "/v1/test/retrieve/id/1", ""); w.Code != 404 {
+		t.Fatalf("got %d after Reset", w.Code)
+	}
+	if w := do("GET", "/v1/users/1", ""); w.Code != 404 {
+		t.Fatalf("got %d after Reset", w.Code)
+	}
+	if err := RegisterRoute("GET", "/v1/test/retrieve", testController); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterRoute("GET", "/v1/users/{id}", testController); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterFilter("user", userFilter{new(interface{})}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A uuid bound from its hex form.
+type uuid [16]byte
+
+func (u *uuid) UnmarshalText(b []byte) error {
+	s := strings.Replace(string(b), "-", "", -1)
+	if len(s) != 32 {
+		return errors.New("Invalid UUID")
+	}
+	_, err := hex.Decode(u[:], []byte(s))
+	if err != nil {
+		return errors.New("Invalid UUID")
+	}
+	return nil
+}
+
+type uuidInput struct {
+	Id uuid
+}
+
+func TestTextUnmarshaler(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", func(t *uuidInput) (string, error) { return hex.EncodeToString(t.Id[:2]), nil })
+	if w := do("GET", "/v1/users/6ba7b810-9dad-11d1-80b4-00c04fd430c8", ""); w.Code != 200 || w.Body.String() != `"6ba7"` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/v1/users/6ba7b810", ""); w.Code != 400 || w.Body.String() != `[{"field":"id","message":"Invalid UUID"}]` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/country/list", testController, WithCache(time.Hour), WithTimeout(time.Second))
+	RegisterRoute("GET", "/v1/country/get", testController)
+	RegisterRoute("GET", "/v1/country/missing", func(t *testInput) (string, error) { return "", ErrNotFound }, WithCache(time.Hour))
+	if w := do("GET", "/v1/country/list", ""); w.Code != 200 || w.Header().Get("Cache-Control") != "max-age=3600" {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	if w := do("GET", "/v1/country/get", ""); w.Header().Get("Cache-Control") != "" {
+		t.Fatalf("got %q without a max age", w.Header().Get("Cache-Control"))
+	}
+	if w := do("GET", "/v1/country/missing", ""); w.Code != 404 || w.Header().Get("Cache-Control") != "" {
+		t.Fatalf("got %d %q on an error", w.Code, w.Header().Get("Cache-Control"))
+	}
+}
+
+type flagInput struct {
+	Active bool
+}
+
+func TestBooleanFlag(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/list", func(t *flagInput) (bool, error) { return t.Active, nil })
+	RegisterRoute("POST", "/v1/users/save", func(t *flagInput) (bool, error) { return t.Active, nil })
+	tests := map[string]string{
+		"?active":       "true",
+		"?active=":      "true",
+		"?active=true":  "true",
+		"?active=false": "false",
+		"":              "false",
+	}
+	for query, want := range tests {
+		if w := do("GET", "/v1/users/list"+query, ""); w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%q: got %d %s, want %s", query, w.Code, w.Body, want)
+		}
+	}
+	if w := do("POST", "/v1/users/save", `{"active":""}`); w.Code != 400 {
+		t.Fatalf("an empty body value is not a flag, got %d", w.Code)
+	}
+}
+
+// Get a not found handler writing its name.
+func namedNotFound(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(name))
+	}
+}
+
+func TestNotFoundForPrefix(t *testing.T) {
+	Reset()
+	SetNotFoundForPrefix("/v1", namedNotFound("v1"))
+	SetNotFoundForPrefix("/v1/admin/", namedNotFound("admin"))
+	SetNotFoundForPrefix("/v2", namedNotFound("v2"))
+	tests := map[string]string{
+		"/v1/users/list":  "v1",
+		"/v1/admin/users": "admin",
+		"/v2/users/list":  "v2",
+		"/v10/users/list": "Resource Not Found.\n",
+	}
+	for path, want := range tests {
+		if w := do("GET", path, ""); w.Code != 404 || w.Body.String() != want {
+			t.Errorf("%s: got %d %q, want %q", path, w.Code, w.Body, want)
+		}
+	}
+}
+
+func TestMalformedPath(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	tests := map[string]int{
+		"/v1/test/retrieve/id":   400,
+		"/v1":                    400,
+		"/v1/test/missing/id/4":  404,
+		"/v1/test/retrieve/id/4": 200,
+	}
+	for path, want := range tests {
+		if w := do("GET", path, ""); w.Code != want {
+			t.Errorf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+	req := make(Request)
+	if _, _, err := match("GET", "/v1/test/retrieve/id", req); err != ErrMalformedPath {
+		t.Errorf("got %v, want ErrMalformedPath", err)
+	}
+	if _, _, err := match("GET", "/v1/test/missing/id/4", req); err != ErrNoHandler {
+		t.Errorf("got %v, want ErrNoHandler", err)
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/slow", slowController)
+	r := httptest.NewRequest("GET", "/v1/test/slow", nil)
+	r.Header.Set(DeadlineHeader, "5ms")
+	if w := serve(r); w.Code != 200 {
+		t.Fatalf("got %d, the header is ignored outside debug mode", w.Code)
+	}
+	DebugMode = true
+	defer func() { DebugMode = false }()
+	if w := serve(r); w.Code != 503 {
+		t.Fatalf("got %d, want 503", w.Code)
+	}
+}
+
+type aliasInput struct {
+	UserId int64 `param:"user_id,userId,uid"`
+}
+
+func TestParamAliases(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/users/save", func(t *aliasInput) (int64, error) { return t.UserId, nil })
+	for _, body := range []string{`{"user_id":3}`, `{"userId":3}`, `{"uid":3}`, `{"uid":3,"user_id":3}`} {
+		if w := do("POST", "/v1/users/save", body); w.Code != 200 || w.Body.String() != "3" {
+			t.Errorf("%s: got %d %s", body, w.Code, w.Body)
+		}
+	}
+	if w := do("POST", "/v1/users/save", `{"uid":3,"user_id":4}`); w.Code != 400 {
+		t.Errorf("got %d for aliases with different values", w.Code)
+	}
+	if w := do("POST", "/v1/users/save", `{"userId":3,"UserId":3}`); w.Code != 404 {
+		t.Errorf("got %d, an aliased field is not bound by its own name", w.Code)
+	}
+}
+
+func TestParamPrecedence(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/users/{count}", func(t *typedInput) (int64, error) { return t.Count, nil })
+	defer func() { ParamPrecedence = FirstWins }()
+	tests := map[Precedence]string{
+		FirstWins:       "1",
+		LastWins:        "3",
+		ErrorOnConflict: `[{"field":"count","message":"Sent with conflicting values"}]`,
+	}
+	for precedence, want := range tests {
+		ParamPrecedence = precedence
+		if w := do("POST", "/v1/users/1?count=2&count=3", `{"count":2}`); w.Body.String() != want {
+			t.Errorf("%d: got %s, want %s", precedence, w.Body, want)
+		}
+	}
+	ParamPrecedence = ErrorOnConflict
+	if w := do("POST", "/v1/users/1?count=1", `{"count":1}`); w.Code != 200 {
+		t.Errorf("got %d for a param repeated with one value", w.Code)
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	Reset()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	RegisterRoute("GET", "/v1/test/hold", func(t *testInput) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "", nil
+	})
+	MaxConcurrent = 2
+	defer func() { MaxConcurrent = 0 }()
+	codes := make(chan int, MaxConcurrent)
+	for i := 0; i < MaxConcurrent; i++ {
+		go func() { codes <- do("GET", "/v1/test/hold", "").Code }()
+		<-started
+	}
+	w := do("GET", "/v1/test/hold", "")
+	if w.Code != 503 || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("got %d %q, want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	close(release)
+	for i := 0; i < MaxConcurrent; i++ {
+		if code := <-codes; code != 200 {
+			t.Fatalf("got %d for a request under the limit", code)
+		}
+	}
+}
+
+type orderItemInput struct {
+	OrderId int64
+	ItemId  int64
+}
+
+func TestTwoPathParams(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/orders/{orderId}/items/{itemId}", func(t *orderItemInput) (*orderItemInput, error) { return t, nil })
+	if w := do("GET", "/v1/orders/10/items/55", ""); w.Code != 200 || w.Body.String() != `{"OrderId":10,"ItemId":55}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	want := `[{"field":"itemId","message":"Invalid integer"},{"field":"orderId","message":"Invalid integer"}]`
+	if w := do("GET", "/v1/orders/x/items/y", ""); w.Code != 400 || w.Body.String() != want {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestParamNames(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	tests := map[string]int{
+		"/v1/test/retrieve/i%3Cd/4": 400,
+		"/v1/test/retrieve/i.d/4":   400,
+		"/v1/test/retrieve/1d/4":    400,
+		"/v1/test/retrieve/%20id/4": 200,
+		"/v1/test/retrieve/id/4":    200,
+	}
+	for path, want := range tests {
+		if w := do("GET", path, ""); w.Code != want {
+			t.Errorf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+	for _, path := range []string{"/v1/users/{i.d}", "/v1/users/{id}/posts/{id}"} {
+		if err := RegisterRoute("GET", path, testController); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+	StrictParamNames = false
+	defer func() { StrictParamNames = true }()
+	if w := do("GET", "/v1/test/retrieve/i.d/4", ""); w.Code != 404 {
+		t.Errorf("got %d, an unknown param name is not found", w.Code)
+	}
+}
+
+func TestRequireJSONContentType(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/test/save", func(t *typedInput) (int64, error) { return t.Count, nil })
+	post := func(contentType string) int {
+		r := httptest.NewRequest("POST", "/v1/test/save", strings.NewReader(`{"count":1}`))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		return serve(r).Code
+	}
+	if code := post("text/plain"); code != 200 {
+		t.Fatalf("got %d with the check off", code)
+	}
+	RequireJSONContentType = true
+	defer func() { RequireJSONContentType = false }()
+	tests := map[string]int{
+		"text/plain":                      415,
+		"":                                415,
+		"application/json":                200,
+		"application/json; charset=utf-8": 200,
+	}
+	for contentType, want := range tests {
+		if code := post(contentType); code != want {
+			t.Errorf("%q: got %d, want %d", contentType, code, want)
+		}
+	}
+}
+
+func TestWithAccepts(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/test/save", func(t *typedInput) (int64, error) { return t.Count, nil }, WithAccepts(JSON))
+	RegisterRoute("POST", "/v1/test/upload", func(t *typedInput) (int64, error) { return t.Count, nil },
+		WithAccepts("application/x-www-form-urlencoded", "multipart/form-data"))
+	post := func(path string, contentType string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		return serve(r)
+	}
+	if w := post("/v1/test/save", "application/x-www-form-urlencoded", "count=1"); w.Code != 415 {
+		t.Fatalf("got %d for a form on a json route", w.Code)
+	}
+	if w := post("/v1/test/save", "application/json; charset=utf-8", `{"count":1}`); w.Code != 200 || w.Body.String() != "1" {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := post("/v1/test/upload", "application/x-www-form-urlencoded", "count=2"); w.Code != 200 || w.Body.String() != "2" {
+		t.Fatalf("got %d %s for a form", w.Code, w.Body)
+	}
+	if w := post("/v1/test/upload", JSON, `{"count":1}`); w.Code != 415 {
+		t.Fatalf("got %d for json on a form route", w.Code)
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	mux := http.NewServeMux()
+	mux.Handle("/api/", StripPrefix("/api/"))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/test/retrieve/id/4", nil))
+	if w.Code != 200 || w.Body.String() != `"4"` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/v1/test/retrieve/id/4", nil))
+	if w.Code != 404 {
+		t.Fatalf("got %d outside the prefix", w.Code)
+	}
+}
+
+type proxyInput struct {
+	Rest  string `path:"remainder"`
+	Query string
+}
+
+func TestPathRemainder(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/proxy/fetch", func(t *proxyInput) (string, error) { return t.Rest + "|" + t.Query, nil })
+	tests := map[string]string{
+		"/v1/proxy/fetch/a/b/c?query=1": `"a/b/c|1"`,
+		"/v1/proxy/fetch/a":             `"a|"`,
+		"/v1/proxy/fetch":               `"|"`,
+		"/v1/proxy/fetch/a/o'b&c":       `"a/o'b\u0026c|"`,
+	}
+	for path, want := range tests {
+		if w := do("GET", path, ""); w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", path, w.Code, w.Body, want)
+		}
+	}
+}
+
+func TestDeletePolicy(t *testing.T) {
+	Reset()
+	deleted := map[string]bool{}
+	RegisterRoute("DELETE", "/v1/users/{id}", func(t *testInput) (string, error) {
+		if deleted[t.Id] {
+			return "", ErrNotFound
+		}
+		deleted[t.Id] = true
+		return "deleted", nil
+	})
+	if w := do("DELETE", "/v1/users/1", ""); w.Code != 200 {
+		t.Fatalf("got %d", w.Code)
+	}
+	if w := do("DELETE", "/v1/users/1", ""); w.Code != 404 {
+		t.Fatalf("got %d deleting twice, want 404", w.Code)
+	}
+	DeleteMissingIsOK = true
+	defer func() { DeleteMissingIsOK = false }()
+	if w := do("DELETE", "/v1/users/1", ""); w.Code != 204 || w.Body.Len() != 0 {
+		t.Fatalf("got %d %s deleting twice, want 204", w.Code, w.Body)
+	}
+}
+
+type lineItem struct {
+	Name string
+	Qty  int64
+}
+
+type bulkInput struct {
+	Items []lineItem
+}
+
+func TestBindStructSlice(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/items/create", func(t *bulkInput) ([]lineItem, error) { return t.Items, nil })
+	w := do("POST", "/v1/items/create", `{"items":[{"name":"a","qty":1},{"name":"b"}]}`)
+	if w.Code != 200 || w.Body.String() != `[{"Name":"a","Qty":1},{"Name":"b","Qty":0}]` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	tests := map[string]string{
+		`{"items":[{"name":"a"},{"qty":"x"}]}`: `[{"field":"items[1].qty","message":"Invalid integer"}]`,
+		`{"items":[{"name":[1]}]}`:             `[{"field":"items[0].name","message":"Invalid string"}]`,
+		`{"items":[{"color":"red"}]}`:          `[{"field":"items[0].color","message":"Unknown field"}]`,
+		`{"items":["a"]}`:                      `[{"field":"items[0]","message":"Invalid object"}]`,
+		`{"items":{"name":"a"}}`:               `[{"field":"items","message":"Invalid list"}]`,
+	}
+	for body, want := range tests {
+		if w := do("POST", "/v1/items/create", body); w.Code != 400 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", body, w.Code, w.Body, want)
+		}
+	}
+}
+
+type filterInput struct {
+	Filter map[string]string
+	Limit  int64
+}
+
+func TestBracketParams(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/search", func(t *filterInput) (*filterInput, error) { return t, nil })
+	w := do("GET", "/v1/users/search?filter[status]=active&filter[type]=x&limit=5", "")
+	if w.Code != 200 || w.Body.String() != `{"Filter":{"status":"active","type":"x"},"Limit":5}` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	w = do("GET", "/v1/users/search?filter[a][b]=x", "")
+	if w.Code != 400 || w.Body.String() != `[{"field":"filter[a][b]","message":"Nested brackets are not supported"}]` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/v1/users/search?other[a]=x", ""); w.Code != 200 {
+		t.Fatalf("got %d, unknown query params are ignored", w.Code)
+	}
+}
+
+type address struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+type customer struct {
+	Name    string    `json:"name"`
+	Address address   `json:"address"`
+	Tags    []string  `json:"tags"`
+	Orders  []float64 `json:"orders"`
+}
+
+type customerInput struct {
+	Id       int64
+	Customer customer `body:"json"`
+}
+
+func TestBodyField(t *testing.T) {
+	Reset()
+	RegisterRoute("PUT", "/v1/customers/{id}", func(t *customerInput) (*customerInput, error) { return t, nil })
+	body := `{"name":"ann","address":{"street":"1 Main St","city":"Leeds"},"tags":["a","b"],"orders":[1.5]}`
+	w := do("PUT", "/v1/customers/7", body)
+	want := `{"Id":7,"Customer":` + body + `}`
+	if w.Code != 200 || w.Body.String() != want {
+		t.Fatalf("got %d %s, want %s", w.Code, w.Body, want)
+	}
+	w = do("PUT", "/v1/customers/7", `{"name":1}`)
+	if w.Code != 400 || w.Body.String() != `[{"field":"customer","message":"Invalid json"}]` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
+
+// Records the outcome of every request.
+type outcomeFilter struct {
+	outcomes *[]Outcome
+}
+
+func (f outcomeFilter) Name() string {
+	return "outcome"
+}
+
+func (f outcomeFilter) PreDispatch(r *http.Request, req Request) error {
+	return nil
+}
+
+func (f outcomeFilter) PostDispatch(r *http.Request, req Request) error {
+	return nil
+}
+
+func (f outcomeFilter) PostDispatchResult(r *http.Request, req Request, o Outcome) error {
+	*f.outcomes = append(*f.outcomes, o)
+	return nil
+}
+
+func TestPostDispatchResult(t *testing.T) {
+	Reset()
+	var outcomes []Outcome
+	RegisterFilter("outcome", outcomeFilter{&outcomes})
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	RegisterRoute("GET", "/v1/users/missing", func(t *testInput) (string, error) { return "", ErrNotFound })
+	RegisterRoute("GET", "/v1/users/invalid", func(t *testInput) (string, error) {
+		return "", HTTPError{Status: 422, Message: "invalid"}
+	})
+	RegisterRoute("GET", "/v1/users/broken", func(t *testInput) (string, error) { return "", errors.New("broken") })
+	_, restore := captureLog()
+	defer restore()
+	for _, path := range []string{"/v1/users/4", "/v1/users/missing", "/v1/users/invalid", "/v1/users/broken"} {
+		do("GET", path, "")
+	}
+	want := []struct {
+		status int
+		value  interface{}
+		failed bool
+	}{
+		{200, "4", false},
+		{404, nil, true},
+		{422, nil, true},
+		{500, nil, true},
+	}
+	if len(outcomes) != len(want) {
+		t.Fatalf("got %d outcomes, want %d", len(outcomes), len(want))
+	}
+	for i, o := range outcomes {
+		if o.Status != want[i].status || (o.Err != nil) != want[i].failed || (want[i].value != nil && o.Value != want[i].value) {
+			t.Errorf("%d: got %+v", i, o)
+		}
+	}
+}
+
+func TestAnyMethod(t *testing.T) {
+	Reset()
+	RegisterRoute(ANY, "/v1/proxy", func(t *testInput) (string, error) { return "proxy", nil })
+	RegisterRoute(ANY, "/v1/users/{id}", func(t *testInput) (string, error) { return "any " + t.Id, nil })
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		w := do(method, "/v1/proxy", "{}")
+		if w.Code != 200 || w.Body.String() != `"proxy"` {
+			t.Errorf("%s: got %d %s", method, w.Code, w.Body)
+		}
+	}
+	if w := do("GET", "/v1/users/4", ""); w.Body.String() != `"4"` {
+		t.Errorf("got %d %s, want the GET route", w.Code, w.Body)
+	}
+	if w := do("DELETE", "/v1/users/4", ""); w.Body.String() != `"any 4"` {
+		t.Errorf("got %d %s, want the ANY route", w.Code, w.Body)
+	}
+	for _, method := range []string{"OPTIONS", "PROPFIND"} {
+		if w := do(method, "/v1/proxy", ""); w.Code != 200 || w.Body.String() != `"proxy"` {
+			t.Errorf("%s: got %d %s, want the ANY route", method, w.Code, w.Body)
+		}
+	}
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	if w := do("OPTIONS", "/v1/test/retrieve", ""); w.Code != 404 || !strings.Contains(w.Body.String(), "not supported") {
+		t.Errorf("got %d %s with no ANY route", w.Code, w.Body)
+	}
+}
+
+func TestStringCoercion(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/test/save", func(t *testInput) (string, error) { return t.Id + " " + t.Name, nil })
+	tests := map[string]string{
+		`{"id":123}`:                    `"123 "`,
+		`{"id":12345678901,"name":1.5}`: `"12345678901 1.5"`,
+		`{"id":true,"name":false}`:      `"true false"`,
+	}
+	for body, want := range tests {
+		if w := do("POST", "/v1/test/save", body); w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", body, w.Code, w.Body, want)
+		}
+	}
+	if w := do("POST", "/v1/test/save", `{"id":{}}`); w.Code != 400 {
+		t.Fatalf("got %d for an object", w.Code)
+	}
+}
+
+type cacheInput struct {
+	TTL time.Duration `param:"ttl"`
+}
+
+func TestBindDuration(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/cache/set", func(t *cacheInput) (int64, error) { return int64(t.TTL / time.Second), nil })
+	RegisterRoute("POST", "/v1/cache/save", func(t *cacheInput) (int64, error) { return int64(t.TTL), nil })
+	if w := do("GET", "/v1/cache/set?ttl=30s", ""); w.Code != 200 || w.Body.String() != "30" {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/v1/cache/save", `{"ttl":1500}`); w.Code != 200 || w.Body.String() != "1500" {
+		t.Fatalf("got %d %s for nanoseconds", w.Code, w.Body)
+	}
+	w := do("GET", "/v1/cache/set?ttl=30x", "")
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "Invalid duration") {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/broken", func(t *testInput) (string, error) { return "", errors.New("database is down") })
+	defer func() { PanicHandler = nil }()
+	PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
+		w.WriteHeader(500)
+		w.Write([]byte("Something went wrong, we are on it"))
+	}
+	logs, restore := captureLog()
+	defer restore()
+	w := do("GET", "/v1/test/broken", "")
+	if w.Code != 500 || w.Body.String() != "Something went wrong, we are on it" {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if !strings.Contains(logs.String(), "database is down") {
+		t.Fatalf("got logs %q", logs)
+	}
+
+	PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
+		w.Write([]byte("partial"))
+		panic("broken handler")
+	}
+	w = do("GET", "/v1/test/broken", "")
+	if w.Code != 500 || strings.Contains(w.Body.String(), "partial") {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if !strings.Contains(logs.String(), "broken handler") {
+		t.Fatalf("got logs %q", logs)
+	}
+}
+
+type idsInput struct {
+	Ids   []int64
+	Names []string `sep:"|"`
+}
+
+func TestBindSlice(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/list", func(t *idsInput) (*idsInput, error) { return t, nil })
+	RegisterRoute("POST", "/v1/users/save", func(t *idsInput) (*idsInput, error) { return t, nil })
+	tests := []struct {
+		method, path, body string
+		want               string
+	}{
+		{"GET", "/v1/users/list?ids=1,2,3", "", `{"Ids":[1,2,3],"Names":null}`},
+		{"GET", "/v1/users/list?ids=1&ids=2,3&names=a,b|c", "", `{"Ids":[1,2,3],"Names":["a,b","c"]}`},
+		{"POST", "/v1/users/save", `{"ids":[4,5]}`, `{"Ids":[4,5],"Names":null}`},
+	}
+	for _, tt := range tests {
+		if w := do(tt.method, tt.path, tt.body); w.Code != 200 || w.Body.String() != tt.want {
+			t.Errorf("%s: got %d %s, want %s", tt.path, w.Code, w.Body, tt.want)
+		}
+	}
+	w := do("GET", "/v1/users/list?ids=1,x", "")
+	if w.Code != 400 || w.Body.String() != `[{"field":"ids[1]","message":"Invalid integer"}]` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+}
+
+type nestedInput struct {
+	User struct {
+		Name    string
+		Age     int64
+		Address struct {
+			City string
+		}
+	}
+}
+
+func TestBindNestedKeys(t *testing.T) {
+	Reset()
+	RegisterRoute("POST", "/v1/users/save", func(t *nestedInput) (*nestedInput, error) { return t, nil })
+	want := `{"User":{"Name":"x","Age":30,"Address":{"City":"y"}}}`
+	for _, body := range []string{
+		`{"user.name":"x","user.age":30,"user.address.city":"y"}`,
+		`{"user":{"name":"x","age":30,"address.city":"y"}}`,
+		`{"user":{"name":"x","age":30,"address":{"city":"y"}}}`,
+	} {
+		if w := do("POST", "/v1/users/save", body); w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", body, w.Code, w.Body, want)
+		}
+	}
+	tests := map[string]string{
+		`{"user":{"name":"x"},"user.age":30}`: `[{"field":"user.age","message":"Conflicts with user"}]`,
+		`{"user.age":"x"}`:                    `[{"field":"user.age","message":"Invalid integer"}]`,
+		`{"user":"x"}`:                        `[{"field":"user","message":"Invalid object"}]`,
+		`{"user":{"address":{"city":"x"},"address.city":"y"}}`: `[{"field":"user.address.city","message":"Conflicts with user.address"}]`,
+	}
+	for body, want := range tests {
+		if w := do("POST", "/v1/users/save", body); w.Code != 400 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", body, w.Code, w.Body, want)
+		}
+	}
+}
+
+func TestBindIntegerBases(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/count", func(t *typedInput) (int64, error) { return t.Count, nil })
+	tests := map[string]string{
+		"0xFF":  "255",
+		"255":   "255",
+		"-0x10": "-16",
+		"0o17":  "15",
+		"0b101": "5",
+		"010":   "10",
+		"0":     "0",
+	}
+	for v, want := range tests {
+		if w := do("GET", "/v1/test/count?count="+v, ""); w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%s: got %d %s, want %s", v, w.Code, w.Body, want)
+		}
+	}
+	if w := do("GET", "/v1/test/count?count=0xZZ", ""); w.Code != 400 {
+		t.Fatalf("got %d for an invalid hex", w.Code)
+	}
+}
+
+// Keeps the params of every request it sees.
+type paramsFilter struct {
+	seen *[]string
+}
+
+func (f paramsFilter) Name() string {
+	return "params"
+}
+
+func (f paramsFilter) PreDispatch(r *http.Request, req Request) error {
+	var names []string
+	for k := range req {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	*f.seen = append(*f.seen, strings.Join(names, ","))
+	return nil
+}
+
+func (f paramsFilter) PostDispatch(r *http.Request, req Request) error {
+	return nil
+}
+
+func TestRequestPool(t *testing.T) {
+	Reset()
+	var seen []string
+	RegisterFilter("params", paramsFilter{&seen})
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	do("GET", "/v1/test/retrieve/id/4/name/a", "")
+	do("GET", "/v1/test/retrieve/id/5", "")
+	w := do("GET", "/v1/test/retrieve?name=b", "")
+	if w.Code != 200 || w.Body.String() != `""` {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	want := []string{"id,name", "id", "name"}
+	if strings.Join(seen, " ") != strings.Join(want, " ") {
+		t.Fatalf("got params %q, want %q", seen, want)
+	}
+}
+
+func BenchmarkDispatch(b *testing.B) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	r := httptest.NewRequest("GET", "/v1/test/retrieve/id/4/name/a", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Dispatch(httptest.NewRecorder(), r)
+	}
+}
+
+func TestHandled(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/report/export", func(w http.ResponseWriter, r *http.Request, t *testInput) (interface{}, error) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(201)
+		w.Write([]byte("id\n" + t.Id + "\n"))
+		return nil, Handled
+	}, WithTimeout(time.Second))
+	w := do("GET", "/v1/report/export/id/4", "")
+	if w.Code != 201 || w.Body.String() != "id\n4\n" || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("got %d %q %q", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	if err := Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAutoHead(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", testController, WithCache(time.Minute))
+	RegisterRoute("GET", "/v1/users/list", testController)
+	RegisterRoute("HEAD", "/v1/users/list", func(t *testInput) (string, error) { return "head", nil })
+	w := do("HEAD", "/v1/users/4", "")
+	if w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "3" ||
+		w.Header().Get("Content-Type") != JSON || w.Header().Get("Cache-Control") != "max-age=60" {
+		t.Fatalf("got %d %q %v", w.Code, w.Body, w.Header())
+	}
+	if w := do("HEAD", "/v1/users/list", ""); w.Code != 200 || w.Header().Get("Content-Length") != "6" {
+		t.Fatalf("explicit HEAD route: got %d %v", w.Code, w.Header())
+	}
+	AutoHead = false
+	defer func() { AutoHead = true }()
+	if w := do("HEAD", "/v1/users/4", ""); w.Code != 404 {
+		t.Fatalf("got %d with AutoHead off", w.Code)
+	}
+}
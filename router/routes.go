@@ -0,0 +1,121 @@
+package router
+
+import (
+	"sort"
+)
+
+type (
+	// RouteMeta describes a route for Routes and the OpenAPI export.
+	RouteMeta struct {
+		Summary string
+		Tags    []string
+	}
+	// RouteDef is a route registered by RegisterAll.
+	// Filters are registered for every route by RegisterFilter.
+	RouteDef struct {
+		Method  string
+		Path    string
+		Handler Node
+		Meta    RouteMeta
+		Options []RouteOption
+	}
+	// RouteInfo is a registered route as listed by Routes.
+	RouteInfo struct {
+		Method string
+		Path   string
+		RouteMeta
+	}
+)
+
+// Describe a route.
+//
+//  Usage:
+//
+//      go_router.RegisterRoute(GET, "/v1/users/{id}", user_controller.Get,
+//          go_router.WithMeta(go_router.RouteMeta{Summary: "Get a user", Tags: []string{"users"}}))
+//
+func WithMeta(m RouteMeta) RouteOption {
+	return func(rt *route) {
+		rt.meta = m
+	}
+}
+
+// Register a table of routes in order. Registration is per route and
+// atomic, a route is registered whole or not at all. Valid routes stay
+// registered, and there is no rollback of the table when others fail.
+// A route whose controller can not be dispatched or whose path can not
+// be registered is reported in the RouteErrors returned, and can be
+// registered again once fixed.
+//
+//  Usage:
+//
+//      err := go_router.RegisterAll([]go_router.RouteDef{
+//          {Method: GET, Path: "/v1/users/{id}", Handler: user_controller.Get},
+//          {Method: POST, Path: "/v1/users/save", Handler: user_controller.Save,
+//              Meta: go_router.RouteMeta{Summary: "Save a user"}},
+//      })
+//
+func RegisterAll(defs []RouteDef) error {
+	var errs RouteErrors
+	for _, d := range defs {
+		opts := append([]RouteOption{WithMeta(d.Meta)}, d.Options...)
+		rt := &route{node: d.Handler}
+		for _, opt := range opts {
+			opt(rt)
+		}
+		mu.RLock()
+		err := checkRoute(rt)
+		mu.RUnlock()
+		if err == nil {
+			err = addRoute(d.Method, d.Path, rt)
+		}
+		if err != nil {
+			errs = append(errs, RouteError{Method: d.Method, Path: d.Path, Err: err})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// List the registered routes, sorted by path then method.
+//
+//  Usage:
+//
+//      for _, v := range go_router.Routes() {
+//          fmt.Println(v.Method, v.Path, v.Summary)
+//      }
+//
+func Routes() []RouteInfo {
+	mu.RLock()
+	defer mu.RUnlock()
+	var list []RouteInfo
+	for _, rt := range sortedRoutes() {
+		list = append(list, RouteInfo{Method: rt.method, Path: rt.path, RouteMeta: rt.meta})
+	}
+	return list
+}
+
+// Get the registered routes and route patterns,
+// sorted by path then method.
+func sortedRoutes() []*route {
+	var list []*route
+	for _, nodes := range routes {
+		for _, rt := range nodes {
+			list = append(list, rt)
+		}
+	}
+	for _, v := range patterns {
+		for _, p := range v {
+			list = append(list, p.route)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].path != list[j].path {
+			return list[i].path < list[j].path
+		}
+		return list[i].method < list[j].method
+	})
+	return list
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRoutes(t *testing.T) {
+	Reset()
+	meta := RouteMeta{Summary: "Get a user", Tags: []string{"users"}}
+	RegisterRoute("GET", "/v1/users/{id}", testController, WithMeta(meta))
+	RegisterRoute("POST", "/v1/users/save", testController)
+	RegisterRoute("GET", "/v1/users/save", testController)
+	want := []RouteInfo{
+		{Method: "GET", Path: "/v1/users/save"},
+		{Method: "POST", Path: "/v1/users/save"},
+		{Method: "GET", Path: "/v1/users/{id}", RouteMeta: meta},
+	}
+	if got := Routes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestRegisterAll(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/list", testController)
+	meta := RouteMeta{Summary: "Save a user"}
+	err := RegisterAll([]RouteDef{
+		{Method: "GET", Path: "/v1/users/{id}", Handler: testController},
+		{Method: "POST", Path: "/v1/users/save", Handler: testController, Meta: meta},
+		{Method: "GET", Path: "/v1/users/list", Handler: testController},
+		{Method: "GET", Path: "/v1/test/{name}", Handler: func(s string) string { return s }},
+		{Method: "GET", Path: "/v1/users/{name}", Handler: testController},
+		{Method: "GET", Path: "/v1/test/retrieve", Handler: testController, Options: []RouteOption{WithCache(time.Minute)}},
+	})
+	want := "GET /v1/users/list: Route path has already been registered, " +
+		"GET /v1/test/{name}: Controller must take a pointer to a struct, " +
+		"GET /v1/users/{name}: Route pattern is ambiguous with /v1/users/{id}"
+	if _, ok := err.(RouteErrors); !ok || err.Error() != want {
+		t.Fatalf("got %v, want %q", err, want)
+	}
+	wantRoutes := []RouteInfo{
+		{Method: "GET", Path: "/v1/test/retrieve"},
+		{Method: "GET", Path: "/v1/users/list"},
+		{Method: "POST", Path: "/v1/users/save", RouteMeta: meta},
+		{Method: "GET", Path: "/v1/users/{id}"},
+	}
+	if got := Routes(); !reflect.DeepEqual(got, wantRoutes) {
+		t.Fatalf("got %+v, want %+v", got, wantRoutes)
+	}
+	if w := do("GET", "/v1/test/retrieve/id/4", ""); w.Code != 200 || w.Header().Get("Cache-Control") != "max-age=60" {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	if err := RegisterAll([]RouteDef{{Method: "GET", Path: "/v1/test/{name}", Handler: testController}}); err != nil {
+		t.Fatalf("got %v registering a fixed route again", err)
+	}
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const EventStream = "text/event-stream"
+
+type (
+	// SSEStream is returned by a controller to push server-sent events
+	// over a long-lived connection instead of a json response.
+	// Stream should return once the context is done. It carries the
+	// values set by filters, and unlike the controller context it is
+	// not bound by the request timeout, so streams are only ended by
+	// the client going away.
+	// Example:
+	//      type Ticker struct{}
+	//      func (t Ticker) Stream(ctx context.Context, w *router.SSEWriter) error {
+	//          for {
+	//              if err := w.Send("tick", time.Now()); err != nil {
+	//                  return err
+	//              }
+	//              time.Sleep(time.Second)
+	//          }
+	//      }
+	//      func Ticks(t *Test) (router.SSEStream, error) {
+	//          return Ticker{}, nil
+	//      }
+	//
+	SSEStream interface {
+		Stream(context.Context, *SSEWriter) error
+	}
+	// SSEWriter writes events to the client, flushing after each one.
+	SSEWriter struct {
+		ctx context.Context
+		w   http.ResponseWriter
+	}
+)
+
+// Send an event to the client.
+// A string is sent as is, any other data as json.
+// Errors once the request context is done or the write fails.
+func (s *SSEWriter) Send(event string, data interface{}) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	var b []byte
+	switch v := data.(type) {
+	case string:
+		b = []byte(v)
+	default:
+		var err error
+		b, err = json.Marshal(v)
+		if err != nil {
+			return err
+		}
+	}
+	var msg strings.Builder
+	if event != "" {
+		fmt.Fprintf(&msg, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fmt.Fprintf(&msg, "data: %s\n", line)
+	}
+	msg.WriteString("\n")
+	if _, err := io.WriteString(s.w, msg.String()); err != nil {
+		return err
+	}
+	flush(s.w)
+	return nil
+}
+
+// Flush the response if the writer supports it.
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Stream the events of a controller to the client.
+func streamEvents(w http.ResponseWriter, r *http.Request, s SSEStream) {
+	w.Header().Set("Content-Type", EventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+	ctx := controllerContext(r)
+	err := s.Stream(ctx, &SSEWriter{ctx: ctx, w: w})
+	if err != nil && ctx.Err() == nil {
+		Logger.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
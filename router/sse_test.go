@@ -0,0 +1,74 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sends a numbered tick until the client goes away,
+// prefixed with the user set by the filter.
+type ticker struct {
+	stopped chan error
+}
+
+func (t ticker) Stream(ctx context.Context, w *SSEWriter) error {
+	user, _ := ctx.Value(userKey{}).(string)
+	for i := 0; ; i++ {
+		if err := w.Send("tick", map[string]interface{}{"user": user, "n": i}); err != nil {
+			t.stopped <- err
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSSEStream(t *testing.T) {
+	Reset()
+	RegisterFilter("user", userFilter{new(interface{})})
+	stopped := make(chan error, 1)
+	RegisterRoute("GET", "/v1/events/ticks", func(t *testInput) (SSEStream, error) {
+		return ticker{stopped}, nil
+	})
+	// the stream outlives the request timeout.
+	RequestTimeout = 10 * time.Millisecond
+	defer func() { RequestTimeout = 0 }()
+	srv := httptest.NewServer(http.HandlerFunc(Dispatch))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/v1/events/ticks", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != EventStream {
+		t.Fatalf("got %q", resp.Header.Get("Content-Type"))
+	}
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(events) < 6 && scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			events = append(events, line)
+		}
+	}
+	want := []string{
+		"event: tick", `data: {"n":0,"user":"alice"}`,
+		"event: tick", `data: {"n":1,"user":"alice"}`,
+		"event: tick", `data: {"n":2,"user":"alice"}`,
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got %q", events)
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the stream did not stop once the client went away")
+	}
+}
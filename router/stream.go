@@ -0,0 +1,116 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// ContentTyper is implemented by a reader returned by a controller
+// that knows the content type of what it reads.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// StreamTrailer is implemented by a stream returned by a controller,
+// an SSEStream, a reader or a named channel type, that sends trailer
+// headers after its body, such as a checksum of what it streamed or
+// the error that ended it. Trailer is called once the stream ends,
+// so the trailers need not be declared. Buffered responses never
+// send trailers.
+type StreamTrailer interface {
+	Trailer() http.Header
+}
+
+// Number of elements written between flushes of a streamed array.
+const streamFlushEvery = 16
+
+// Check if a controller returned a channel to stream.
+func isStream(v reflect.Value) bool {
+	return v.Kind() == reflect.Chan && v.Type().ChanDir()&reflect.RecvDir != 0
+}
+
+// Stream the elements received from a channel as a json array,
+// until the channel is closed or the request context is done.
+// An element that can not be marshaled ends the array early, as does
+// the client going away, and both are logged since the array still
+// looks complete. A failed write ends the stream without closing the
+// array. A nil channel is an empty array.
+func streamArray(w http.ResponseWriter, r *http.Request, ch reflect.Value) {
+	w.Header().Set("Content-Type", JSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("[")); err != nil {
+		Logger.Printf("%s %s: can not write the stream: %v", r.Method, r.URL.Path, err)
+		return
+	}
+	if !ch.IsNil() && !streamElements(w, r, ch) {
+		return
+	}
+	w.Write([]byte("]"))
+	flush(w)
+}
+
+// Write the elements of a streamed array.
+// Returns false once a write fails.
+func streamElements(w http.ResponseWriter, r *http.Request, ch reflect.Value) bool {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.Context().Done())},
+	}
+	for n := 0; ; n++ {
+		chosen, v, ok := reflect.Select(cases)
+		if chosen == 1 {
+			Logger.Printf("%s %s: stream cut off after %d elements: %v", r.Method, r.URL.Path, n, r.Context().Err())
+			return true
+		}
+		if !ok {
+			return true
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			Logger.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			return true
+		}
+		if n > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			Logger.Printf("%s %s: can not write the stream: %v", r.Method, r.URL.Path, err)
+			return false
+		}
+		if (n+1)%streamFlushEvery == 0 {
+			flush(w)
+		}
+	}
+}
+
+// Copy a reader returned by a controller to the response, as an
+// application/octet-stream unless it is a ContentTyper.
+// A failed copy is logged, the response being already started.
+func streamReader(w http.ResponseWriter, r *http.Request, rd io.Reader) {
+	contentType := "application/octet-stream"
+	if c, ok := rd.(ContentTyper); ok && c.ContentType() != "" {
+		contentType = c.ContentType()
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, rd); err != nil {
+		Logger.Printf("%s %s: can not write the stream: %v", r.Method, r.URL.Path, err)
+		return
+	}
+	flush(w)
+}
+
+// Set the trailers of a stream once its body is written.
+func writeTrailers(w http.ResponseWriter, stream interface{}) {
+	t, ok := stream.(StreamTrailer)
+	if !ok {
+		return
+	}
+	for k, v := range t.Trailer() {
+		for _, value := range v {
+			w.Header().Add(http.TrailerPrefix+k, value)
+		}
+	}
+}
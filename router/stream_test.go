@@ -0,0 +1,170 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamArray(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/list", func(t *testInput) (<-chan interface{}, error) {
+		ch := make(chan interface{})
+		go func() {
+			defer close(ch)
+			for i := 1; i <= 3; i++ {
+				ch <- map[string]int{"id": i}
+			}
+		}()
+		return ch, nil
+	})
+	w := do("GET", "/v1/users/list", "")
+	if w.Code != 200 || w.Header().Get("Content-Type") != JSON {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Body.String() != `[{"id":1},{"id":2},{"id":3}]` {
+		t.Fatalf("got %s", w.Body)
+	}
+}
+
+func TestStreamArrayEndsEarly(t *testing.T) {
+	Reset()
+	logged, restore := captureLog()
+	defer restore()
+	RegisterRoute("GET", "/v1/users/bad", func(t *testInput) (chan interface{}, error) {
+		ch := make(chan interface{}, 2)
+		ch <- 1
+		ch <- func() {}
+		return ch, nil
+	})
+	RegisterRoute("GET", "/v1/users/none", func(t *testInput) (chan interface{}, error) {
+		return nil, nil
+	})
+	RegisterRoute("GET", "/v1/users/open", func(t *testInput) (chan interface{}, error) {
+		ch := make(chan interface{}, 1)
+		ch <- 1
+		return ch, nil
+	})
+	if w := do("GET", "/v1/users/bad", ""); w.Body.String() != `[1]` {
+		t.Fatalf("got %s", w.Body)
+	}
+	if w := do("GET", "/v1/users/none", ""); w.Body.String() != `[]` {
+		t.Fatalf("got %s for a nil channel", w.Body)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/v1/users/open", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		Dispatch(w, r)
+		close(done)
+	}()
+	cancel()
+	<-done
+	if !strings.Contains(logged.String(), "/v1/users/open: stream cut off") {
+		t.Fatalf("got log %q", logged)
+	}
+}
+
+// Reads a body and records whether it was closed.
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *trackedBody) ContentType() string {
+	return "text/csv"
+}
+
+func TestStreamReader(t *testing.T) {
+	Reset()
+	body := &trackedBody{Reader: strings.NewReader("id,name\n4,alice\n")}
+	RegisterRoute("GET", "/v1/report/export", func(t *testInput) (io.ReadCloser, error) { return body, nil })
+	w := do("GET", "/v1/report/export", "")
+	if w.Code != 200 || w.Body.String() != "id,name\n4,alice\n" || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("got %d %q %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	if !body.closed {
+		t.Fatal("the body was not closed")
+	}
+
+	body = &trackedBody{Reader: strings.NewReader("id,name\n")}
+	_, restore := captureLog()
+	defer restore()
+	Dispatch(failingWriter{httptest.NewRecorder()}, httptest.NewRequest("GET", "/v1/report/export", nil))
+	if !body.closed {
+		t.Fatal("the body was not closed after a failed write")
+	}
+}
+
+// Sends the checksum of what it read as a trailer.
+type checksumReader struct {
+	r   io.Reader
+	sum hash.Hash32
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.sum.Write(p[:n])
+	return n, err
+}
+
+func (c *checksumReader) Close() error {
+	return nil
+}
+
+func (c *checksumReader) Trailer() http.Header {
+	return http.Header{"X-Checksum": {fmt.Sprintf("%08x", c.sum.Sum32())}}
+}
+
+// A buffered response, whose trailer is never sent.
+type trailedResult struct {
+	Name string
+}
+
+func (trailedResult) Trailer() http.Header {
+	return http.Header{"X-Checksum": {"1"}}
+}
+
+func TestStreamTrailer(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/files/get", func(t *testInput) (io.ReadCloser, error) {
+		return &checksumReader{r: strings.NewReader("hello"), sum: crc32.NewIEEE()}, nil
+	})
+	RegisterRoute("GET", "/v1/files/info", func(t *testInput) (trailedResult, error) {
+		return trailedResult{Name: "a"}, nil
+	})
+	srv := httptest.NewServer(http.HandlerFunc(Dispatch))
+	defer srv.Close()
+	get := func(path string) (string, http.Header) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b), resp.Trailer
+	}
+	body, trailer := get("/v1/files/get")
+	if want := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte("hello"))); body != "hello" || trailer.Get("X-Checksum") != want {
+		t.Fatalf("got %q, trailer %v, want %s", body, trailer, want)
+	}
+	if body, trailer := get("/v1/files/info"); body != `{"Name":"a"}` || len(trailer) != 0 {
+		t.Fatalf("got %q, trailer %v", body, trailer)
+	}
+}
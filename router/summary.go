@@ -0,0 +1,91 @@
+package router
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// RequestSummary describes a request once its response is written.
+type RequestSummary struct {
+	Method string
+	// url path of the request.
+	Path string
+	// path of the route it matched, empty when it matched none.
+	Route     string
+	Status    int
+	Duration  time.Duration
+	RequestID string
+}
+
+// Run the response callbacks on the goroutine of the request rather
+// than each on its own, delaying the end of the request to them.
+var InlineResponseCallbacks = false
+
+// called with every summary, guarded by mu.
+var responseCallbacks []func(RequestSummary)
+
+// Register a callback run once a response is written, for work the
+// client should not wait on such as audit logs. Unlike PostDispatch
+// it sees the final status of every request. Callbacks run on their
+// own goroutine unless InlineResponseCallbacks is set, and a panic
+// in one is logged.
+//
+//  Usage:
+//
+//      go_router.OnResponse(func(s go_router.RequestSummary) {
+//          audit.Record(s.RequestID, s.Method, s.Path, s.Status)
+//      })
+//
+func OnResponse(fn func(RequestSummary)) {
+	mu.Lock()
+	defer mu.Unlock()
+	responseCallbacks = append(responseCallbacks, fn)
+}
+
+// Get the registered response callbacks.
+func getResponseCallbacks() []func(RequestSummary) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return responseCallbacks
+}
+
+// Observe a request whose response is written and run the callbacks.
+func finishRequest(r *http.Request, rt *route, status int, start time.Time) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	d := time.Since(start)
+	observe(r, rt, status, d)
+	callbacks := getResponseCallbacks()
+	if len(callbacks) == 0 {
+		return
+	}
+	s := RequestSummary{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Status:    status,
+		Duration:  d,
+		RequestID: r.Header.Get(RequestIDHeader),
+	}
+	if rt != nil {
+		s.Route = rt.path
+	}
+	for _, fn := range callbacks {
+		if InlineResponseCallbacks {
+			runCallback(r, fn, s)
+		} else {
+			go runCallback(r, fn, s)
+		}
+	}
+}
+
+// Run a response callback, logging a panic.
+func runCallback(r *http.Request, fn func(RequestSummary), s RequestSummary) {
+	defer func() {
+		if err := recover(); err != nil {
+			logPanic(r, err, debug.Stack())
+		}
+	}()
+	fn(s)
+}
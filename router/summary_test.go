@@ -0,0 +1,51 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOnResponse(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	summaries := make(chan RequestSummary, 1)
+	OnResponse(func(s RequestSummary) { summaries <- s })
+	r := httptest.NewRequest("GET", "/v1/users/4", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	w := serve(r)
+	select {
+	case s := <-summaries:
+		if s.Status != 200 || s.Method != "GET" || s.Path != "/v1/users/4" || s.Route != "/v1/users/{id}" || s.RequestID != "abc" {
+			t.Fatalf("got %+v", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the callback did not run")
+	}
+	if w.Body.String() != `"4"` {
+		t.Fatalf("got %s", w.Body)
+	}
+}
+
+func TestInlineResponseCallbacks(t *testing.T) {
+	Reset()
+	defer func() { InlineResponseCallbacks = false }()
+	InlineResponseCallbacks = true
+	RegisterRoute("GET", "/v1/users/{id}", func(t *testInput) (string, error) { return "", ErrNotFound })
+	var body string
+	var status int
+	w := httptest.NewRecorder()
+	OnResponse(func(s RequestSummary) {
+		status, body = s.Status, w.Body.String()
+	})
+	OnResponse(func(s RequestSummary) { panic("audit is down") })
+	logs, restore := captureLog()
+	defer restore()
+	Dispatch(w, httptest.NewRequest("GET", "/v1/users/4", nil))
+	if status != 404 || body != w.Body.String() || body == "" {
+		t.Fatalf("got %d %q, the callback ran before the body was written", status, body)
+	}
+	if logs.Len() == 0 {
+		t.Fatal("expected the panicking callback to be logged")
+	}
+}
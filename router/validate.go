@@ -0,0 +1,222 @@
+package router
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// RouteError describes a route whose controller can not be dispatched.
+	RouteError struct {
+		Method string
+		Path   string
+		Err    error
+	}
+	// RouteErrors holds every misconfigured route found by Validate,
+	// or left out by RegisterAll.
+	RouteErrors []RouteError
+)
+
+func (e RouteError) Error() string {
+	return e.Method + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e RouteErrors) Error() string {
+	s := make([]string, len(e))
+	for i, v := range e {
+		s[i] = v.Error()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Validatable is implemented by a controller input struct that
+// checks its own params. Validate is called once the params are bound,
+// before the controller, and an error rejects the request with a 400.
+// FieldErrors are written as for params that could not be bound,
+// an HTTPError as it is, and any other error as its message.
+// Example:
+//      func (p *Payment) Validate() error {
+//          if p.Amount < 0 {
+//              return errors.New("Amount can not be negative")
+//          }
+//          return nil
+//      }
+//
+type Validatable interface {
+	Validate() error
+}
+
+// Reject a request whose bound input does not validate.
+// Returns false when the request is done.
+func validInput(w http.ResponseWriter, r *http.Request, t reflect.Value) bool {
+	v, ok := t.Interface().(Validatable)
+	if !ok {
+		return true
+	}
+	err := v.Validate()
+	if err == nil {
+		return true
+	}
+	if errs, ok := err.(FieldErrors); ok {
+		badParams(w, r, errs)
+		return false
+	}
+	e, ok := asHTTPError(err)
+	if !ok {
+		e = HTTPError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	writeHTTPError(w, r, e)
+	return false
+}
+
+// Check that params can be bound to every exported field of a struct.
+func checkFields(t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		ok := true
+		switch {
+		case decoders[f.Type] != nil:
+			// bound by its param decoder.
+		case f.Tag.Get("router") == "query":
+			ok = isStringMap(f.Type, reflect.String)
+		case f.Tag.Get("router") == "present":
+			ok = (f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.String) ||
+				isStringMap(f.Type, reflect.Bool)
+		case f.Tag.Get("body") == "json":
+			ok = f.Type.Kind() == reflect.Struct ||
+				(f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct)
+		case f.Tag.Get("path") == "remainder":
+			ok = f.Type.Kind() == reflect.String
+		case isStringMap(f.Type, reflect.String):
+			// bound from params in bracket notation.
+		case isStructSlice(f.Type):
+			if err := checkFields(f.Type.Elem()); err != nil {
+				return errors.New(f.Name + ": " + err.Error())
+			}
+		case isStructField(f.Type):
+			if err := checkFields(f.Type); err != nil {
+				return errors.New(f.Name + ": " + err.Error())
+			}
+		case isParamSlice(f.Type):
+			_, ok = fieldSchema(f.Type.Elem())
+		default:
+			_, ok = fieldSchema(f.Type)
+		}
+		if !ok {
+			return errors.New("Field " + f.Name + " of type " + f.Type.String() + " can not be bound")
+		}
+	}
+	return nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Check the result of a controller marshals to json, failing for a
+// struct whose fields are all unexported, which marshals to {}.
+// Channels are streamed and interfaces are only known once returned.
+func checkResult(n Node) error {
+	t := reflect.TypeOf(n)
+	if t.NumOut() == 0 {
+		return nil
+	}
+	res := t.Out(0)
+	for res.Kind() == reflect.Ptr {
+		res = res.Elem()
+	}
+	if res.Implements(jsonMarshalerType) || reflect.PtrTo(res).Implements(jsonMarshalerType) ||
+		res.Implements(textMarshalerType) || reflect.PtrTo(res).Implements(textMarshalerType) {
+		return nil
+	}
+	switch res.Kind() {
+	case reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return errors.New("Result type " + res.String() + " can not be marshaled")
+	case reflect.Struct:
+		if res.NumField() == 0 {
+			return nil
+		}
+		for i := 0; i < res.NumField(); i++ {
+			if f := res.Field(i); f.PkgPath == "" || f.Anonymous {
+				return nil
+			}
+		}
+		return errors.New("Result type " + res.String() + " has no exported fields")
+	}
+	return nil
+}
+
+// Check a controller can be dispatched, along with
+// the other versions of its path.
+func checkRoute(rt *route) error {
+	t, err := inputType(rt.node)
+	if err != nil {
+		return err
+	}
+	if err := checkFields(t); err != nil {
+		return err
+	}
+	if StrictResponses {
+		if err := checkResult(rt.node); err != nil {
+			return err
+		}
+	}
+	for v, variant := range rt.versions {
+		if variant == rt {
+			continue
+		}
+		if err := checkRoute(variant); err != nil {
+			return errors.New("Version " + v + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Check every registered route, so a misconfigured controller
+// fails at startup rather than on its first request.
+// The error is RouteErrors naming each bad route.
+//
+//  Usage:
+//
+//      if err := go_router.Validate(); err != nil {
+//          log.Fatal(err)
+//      }
+//
+func Validate() error {
+	mu.RLock()
+	defer mu.RUnlock()
+	var errs RouteErrors
+	for method, nodes := range routes {
+		for path, rt := range nodes {
+			if err := checkRoute(rt); err != nil {
+				errs = append(errs, RouteError{Method: method, Path: path, Err: err})
+			}
+		}
+	}
+	for method, v := range patterns {
+		for _, p := range v {
+			if err := checkRoute(p.route); err != nil {
+				errs = append(errs, RouteError{Method: method, Path: p.path, Err: err})
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		if errs[i].Path != errs[j].Path {
+			return errs[i].Path < errs[j].Path
+		}
+		return errs[i].Method < errs[j].Method
+	})
+	return errs
+}
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"errors"
+	"testing"
+)
+
+type badFieldInput struct {
+	Id    int64
+	Ratio float32
+}
+
+type badItemInput struct {
+	Items []struct {
+		Tags []string
+		Size complex64
+	}
+}
+
+func TestValidate(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	RegisterRoute("GET", "/v1/users/{id}", func(t *patchInput) (string, error) { return "", nil })
+	RegisterRoute("POST", "/v1/bulk/create", func(t *bulkInput) (string, error) { return "", nil })
+	RegisterRoute("GET", "/v1/users/list", func(t *idsInput) (string, error) { return "", nil })
+	if err := Validate(); err != nil {
+		t.Fatal(err)
+	}
+	RegisterRoute("GET", "/v1/test/ratio", func(t *badFieldInput) (string, error) { return "", nil })
+	RegisterRoute("POST", "/v1/test/items", func(t *badItemInput) (string, error) { return "", nil })
+	RegisterRoute("GET", "/v1/test/{name}", func(s string) string { return s })
+	err := Validate()
+	errs, ok := err.(RouteErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("got %v", err)
+	}
+	want := "POST /v1/test/items: Items: Field Size of type complex64 can not be bound, " +
+		"GET /v1/test/ratio: Field Ratio of type float32 can not be bound, " +
+		"GET /v1/test/{name}: Controller must take a pointer to a struct"
+	if err.Error() != want {
+		t.Fatalf("got %q, want %q", err, want)
+	}
+}
+
+type paymentInput struct {
+	Amount int64
+}
+
+func (p *paymentInput) Validate() error {
+	if p.Amount < 0 {
+		return errors.New("Amount can not be negative")
+	}
+	if p.Amount > 1000 {
+		return FieldErrors{{Field: "amount", Message: "Over the limit"}}
+	}
+	return nil
+}
+
+func TestValidatable(t *testing.T) {
+	Reset()
+	called := 0
+	RegisterRoute("POST", "/v1/payments/create", func(t *paymentInput) (int64, error) {
+		called++
+		return t.Amount, nil
+	})
+	tests := []struct {
+		body string
+		code int
+		want string
+	}{
+		{`{"amount":5}`, 200, `5`},
+		{`{"amount":-5}`, 400, `{"status":400,"message":"Amount can not be negative"}`},
+		{`{"amount":5000}`, 400, `[{"field":"amount","message":"Over the limit"}]`},
+	}
+	for _, tt := range tests {
+		if w := do("POST", "/v1/payments/create", tt.body); w.Code != tt.code || w.Body.String() != tt.want {
+			t.Errorf("%s: got %d %s, want %d %s", tt.body, w.Code, w.Body, tt.code, tt.want)
+		}
+	}
+	if called != 1 {
+		t.Fatalf("the controller ran %d times", called)
+	}
+}
+
+type hiddenResult struct {
+	id   int64
+	name string
+}
+
+func TestStrictResponses(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", func(t *testInput) (*hiddenResult, error) { return &hiddenResult{}, nil })
+	RegisterRoute("GET", "/v1/users/list", func(t *testInput) (func(), error) { return nil, nil })
+	RegisterRoute("GET", "/v1/test/retrieve", testController)
+	RegisterRoute("GET", "/v1/test/empty", func(t *testInput) (struct{}, error) { return struct{}{}, nil })
+	if err := Validate(); err != nil {
+		t.Fatalf("got %v when not strict", err)
+	}
+	StrictResponses = true
+	defer func() { StrictResponses = false }()
+	want := "GET /v1/users/list: Result type func() can not be marshaled, " +
+		"GET /v1/users/{id}: Result type router.hiddenResult has no exported fields"
+	if err := Validate(); err == nil || err.Error() != want {
+		t.Fatalf("got %v, want %q", err, want)
+	}
+}
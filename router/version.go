@@ -0,0 +1,87 @@
+package router
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Version served to requests whose Accept header names none,
+// the first version registered for a path when empty.
+var DefaultVersion string
+
+// Register a route as one version of a resource, picked by the
+// version of the vendor media type a request accepts, as v2 in
+// Accept: application/vnd.myapp.v2+json
+// Versions of a path are registered like any route, each with its
+// own controller and options. A request for a version that is not
+// registered gets a 406.
+//
+//  Usage:
+//
+//      go_router.RegisterRoute(GET, "/v1/users/{id}", user_controller.Get)
+//      go_router.RegisterRoute(GET, "/v1/users/{id}", user_controller.GetV2, go_router.WithVersion("v2"))
+//
+func WithVersion(v string) RouteOption {
+	return func(rt *route) {
+		rt.version = v
+	}
+}
+
+// Get the version of the vendor media type in an Accept header,
+// the last dotted part of its subtype. Empty when there is none.
+func acceptVersion(r *http.Request) string {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil || !strings.HasPrefix(t, "application/vnd.") {
+			continue
+		}
+		t = strings.SplitN(t, "+", 2)[0]
+		if i := strings.LastIndex(t, "."); i > len("application/vnd") {
+			return t[i+1:]
+		}
+	}
+	return ""
+}
+
+// Add a version of a path that is already registered.
+// Returns false when neither route has a version, which is
+// a plain duplicate.
+func addVersion(existing *route, rt *route) (bool, error) {
+	if existing.versions == nil && existing.version == rt.version {
+		return false, nil
+	}
+	if existing.versions == nil {
+		existing.versions = map[string]*route{existing.version: existing}
+	}
+	if _, ok := existing.versions[rt.version]; ok {
+		return true, errors.New("Route version has already been registered")
+	}
+	existing.versions[rt.version] = rt
+	return true, nil
+}
+
+// Get the version of a route a request asks for, the route first
+// registered for the path when it asks for none and DefaultVersion
+// is not registered. Returns nil when the version is not registered.
+func (rt *route) variant(r *http.Request) *route {
+	requested := acceptVersion(r)
+	v := requested
+	if v == "" {
+		v = DefaultVersion
+	}
+	if rt.versions == nil {
+		if rt.version == v || requested == "" {
+			return rt
+		}
+		return nil
+	}
+	if variant, ok := rt.versions[v]; ok {
+		return variant
+	}
+	if requested == "" {
+		return rt
+	}
+	return nil
+}
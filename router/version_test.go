@@ -0,0 +1,60 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func versionedRequest(accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/v1/users/4", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	return serve(r)
+}
+
+func TestVersions(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", func(t *testInput) (string, error) { return "v1 " + t.Id, nil }, WithVersion("v1"))
+	RegisterRoute("GET", "/v1/users/{id}", func(t *testInput) (string, error) { return "v2 " + t.Id, nil }, WithVersion("v2"))
+	if err := RegisterRoute("GET", "/v1/users/{id}", testController, WithVersion("v2")); err == nil {
+		t.Fatal("expected an error for a version registered twice")
+	}
+	tests := []struct {
+		accept string
+		code   int
+		body   string
+	}{
+		{"application/vnd.myapp.v1+json", 200, `"v1 4"`},
+		{"application/vnd.myapp.v2+json", 200, `"v2 4"`},
+		{"text/html, application/vnd.myapp.v2+json;q=0.9", 200, `"v2 4"`},
+		{"", 200, `"v1 4"`},
+		{"application/json", 200, `"v1 4"`},
+		{"application/vnd.myapp.v3+json", 406, ""},
+	}
+	for _, tt := range tests {
+		w := versionedRequest(tt.accept)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%q: got %d %s", tt.accept, w.Code, w.Body)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("%q: got Vary %q", tt.accept, w.Header().Get("Vary"))
+		}
+	}
+	defer func() { DefaultVersion = "" }()
+	DefaultVersion = "v2"
+	if w := versionedRequest(""); w.Body.String() != `"v2 4"` {
+		t.Fatalf("got %s for the default version", w.Body)
+	}
+}
+
+func TestUnversionedRoute(t *testing.T) {
+	Reset()
+	RegisterRoute("GET", "/v1/users/{id}", testController)
+	if err := RegisterRoute("GET", "/v1/users/{id}", testController); err == nil {
+		t.Fatal("expected an error for a duplicate route")
+	}
+	if w := versionedRequest("application/vnd.myapp.v9+json"); w.Code != 200 || len(w.Header()["Vary"]) != 1 {
+		t.Fatalf("got %d %q", w.Code, w.Header()["Vary"])
+	}
+}